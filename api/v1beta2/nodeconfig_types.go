@@ -46,6 +46,40 @@ type NodeConfigSpec struct {
 	Crontabs modules.Crontabs `json:"crontabs,omitempty"`
 	// GrubKernelConfig contains kernel version and command line arguments for GRUB configuration
 	GrubKernelConfig modules.GrubKernel `json:"grubKernelConfig,omitempty"`
+	// List of SSH public keys to add to the users' authorized_keys
+	SSHAuthorizedKeys modules.SSHAuthorizedKeys `json:"sshAuthorizedKeys,omitempty"`
+	// List of files to install in /etc/sudoers.d
+	Sudoers modules.Sudoers `json:"sudoers,omitempty"`
+	// List of files, directories and symlinks managed in the host
+	Files modules.Files `json:"files,omitempty"`
+	// List of filesystems to mount in the host
+	Mounts modules.Mounts `json:"mounts,omitempty"`
+	// Defines the swap configuration of the host
+	Swap modules.Swap `json:"swap,omitempty"`
+	// Hugepages and CPU isolation of the host
+	PerformanceProfile modules.PerformanceProfile `json:"performanceProfile,omitempty"`
+	// List of attributes to set in /sys
+	SysfsAttributes modules.SysfsAttributes `json:"sysfsAttributes,omitempty"`
+	// List of udev rules to install in /etc/udev/rules.d
+	UdevRules modules.UdevRules `json:"udevRules,omitempty"`
+	// Time synchronization and timezone of the host
+	TimeSync modules.TimeSync `json:"timeSync,omitempty"`
+	// DNS resolver configuration of the host
+	Resolver modules.Resolver `json:"resolver,omitempty"`
+	// List of netplan files to install in /etc/netplan
+	Netplan modules.Netplan `json:"netplan,omitempty"`
+	// Firewall table owned by the operator
+	Nftables modules.Nftables `json:"nftables,omitempty"`
+	// Resource limits of the users and of systemd services
+	Limits modules.Limits `json:"limits,omitempty"`
+	// Storage and retention of systemd-journald
+	Journald modules.Journald `json:"journald,omitempty"`
+	// Log files rotated by logrotate
+	Logrotate modules.Logrotate `json:"logrotate,omitempty"`
+	// Registries and configuration drop-ins of containerd
+	Containerd modules.Containerd `json:"containerd,omitempty"`
+	// Settings of the KubeletConfiguration, rolled out one node at a time
+	KubeletConfig modules.KubeletConfig `json:"kubeletConfig,omitempty"`
 
 	// Defines the target nodes for this NodeConfig (optional, default is apply to all nodes)
 	NodeSelector []metav1.LabelSelectorRequirement `json:"nodeSelector,omitempty"`
@@ -63,6 +97,8 @@ type NodeStatus struct {
 	LastGeneration int64          `json:"lastGeneration,omitempty"`
 	Status         NodeStatusType `json:"status,omitempty"`
 	Error          string         `json:"error,omitempty"`
+	// Messages reported by the modules about the items they manage
+	Modules []modules.ModuleStatus `json:"modules,omitempty"`
 }
 
 type ConditionType string
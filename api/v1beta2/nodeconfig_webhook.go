@@ -171,6 +171,54 @@ func (nv *NodeConfigValidator) validateModulePresent(ctx context.Context, nc *No
 		if nc.Spec.SystemdOverrides.IsPresent() && nodeConfig.Spec.SystemdOverrides.IsPresent() {
 			return getError("systemdOverrides")
 		}
+		if nc.Spec.SSHAuthorizedKeys.IsPresent() && nodeConfig.Spec.SSHAuthorizedKeys.IsPresent() {
+			return getError("sshAuthorizedKeys")
+		}
+		if nc.Spec.Sudoers.IsPresent() && nodeConfig.Spec.Sudoers.IsPresent() {
+			return getError("sudoers")
+		}
+		if nc.Spec.Files.IsPresent() && nodeConfig.Spec.Files.IsPresent() {
+			return getError("files")
+		}
+		if nc.Spec.Mounts.IsPresent() && nodeConfig.Spec.Mounts.IsPresent() {
+			return getError("mounts")
+		}
+		if nc.Spec.Swap.IsPresent() && nodeConfig.Spec.Swap.IsPresent() {
+			return getError("swap")
+		}
+		if nc.Spec.PerformanceProfile.IsPresent() && nodeConfig.Spec.PerformanceProfile.IsPresent() {
+			return getError("performanceProfile")
+		}
+		if nc.Spec.SysfsAttributes.IsPresent() && nodeConfig.Spec.SysfsAttributes.IsPresent() {
+			return getError("sysfsAttributes")
+		}
+		if nc.Spec.UdevRules.IsPresent() && nodeConfig.Spec.UdevRules.IsPresent() {
+			return getError("udevRules")
+		}
+		if nc.Spec.TimeSync.IsPresent() && nodeConfig.Spec.TimeSync.IsPresent() {
+			return getError("timeSync")
+		}
+		if nc.Spec.Resolver.IsPresent() && nodeConfig.Spec.Resolver.IsPresent() {
+			return getError("resolver")
+		}
+		if nc.Spec.Netplan.IsPresent() && nodeConfig.Spec.Netplan.IsPresent() {
+			return getError("netplan")
+		}
+		if nc.Spec.Nftables.IsPresent() && nodeConfig.Spec.Nftables.IsPresent() {
+			return getError("nftables")
+		}
+		if nc.Spec.Limits.IsPresent() && nodeConfig.Spec.Limits.IsPresent() {
+			return getError("limits")
+		}
+		if nc.Spec.Journald.IsPresent() && nodeConfig.Spec.Journald.IsPresent() {
+			return getError("journald")
+		}
+		if nc.Spec.Containerd.IsPresent() && nodeConfig.Spec.Containerd.IsPresent() {
+			return getError("containerd")
+		}
+		if nc.Spec.KubeletConfig.IsPresent() && nodeConfig.Spec.KubeletConfig.IsPresent() {
+			return getError("kubeletConfig")
+		}
 	}
 	return nil
 }
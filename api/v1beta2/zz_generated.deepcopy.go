@@ -21,6 +21,7 @@ limitations under the License.
 package v1beta2
 
 import (
+	"github.com/whitestack/node-config-operator/internal/modules"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -131,6 +132,23 @@ func (in *NodeConfigSpec) DeepCopyInto(out *NodeConfigSpec) {
 	in.Certificates.DeepCopyInto(&out.Certificates)
 	in.Crontabs.DeepCopyInto(&out.Crontabs)
 	in.GrubKernelConfig.DeepCopyInto(&out.GrubKernelConfig)
+	in.SSHAuthorizedKeys.DeepCopyInto(&out.SSHAuthorizedKeys)
+	in.Sudoers.DeepCopyInto(&out.Sudoers)
+	in.Files.DeepCopyInto(&out.Files)
+	in.Mounts.DeepCopyInto(&out.Mounts)
+	in.Swap.DeepCopyInto(&out.Swap)
+	in.PerformanceProfile.DeepCopyInto(&out.PerformanceProfile)
+	in.SysfsAttributes.DeepCopyInto(&out.SysfsAttributes)
+	in.UdevRules.DeepCopyInto(&out.UdevRules)
+	in.TimeSync.DeepCopyInto(&out.TimeSync)
+	in.Resolver.DeepCopyInto(&out.Resolver)
+	in.Netplan.DeepCopyInto(&out.Netplan)
+	in.Nftables.DeepCopyInto(&out.Nftables)
+	in.Limits.DeepCopyInto(&out.Limits)
+	in.Journald.DeepCopyInto(&out.Journald)
+	in.Logrotate.DeepCopyInto(&out.Logrotate)
+	in.Containerd.DeepCopyInto(&out.Containerd)
+	in.KubeletConfig.DeepCopyInto(&out.KubeletConfig)
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make([]v1.LabelSelectorRequirement, len(*in))
@@ -157,7 +175,7 @@ func (in *NodeConfigStatus) DeepCopyInto(out *NodeConfigStatus) {
 		in, out := &in.Nodes, &out.Nodes
 		*out = make(map[string]NodeStatus, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 	if in.Conditions != nil {
@@ -180,6 +198,11 @@ func (in *NodeConfigStatus) DeepCopy() *NodeConfigStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeStatus) DeepCopyInto(out *NodeStatus) {
 	*out = *in
+	if in.Modules != nil {
+		in, out := &in.Modules, &out.Modules
+		*out = make([]modules.ModuleStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStatus.
@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 
@@ -53,12 +54,16 @@ type NodeConfigReconciler struct {
 	Scheme          *runtime.Scheme
 	NodeName        string
 	IgnoreNodeReady bool
+	Recorder        record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=configuration.whitestack.com,resources=nodeconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=configuration.whitestack.com,resources=nodeconfigs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=configuration.whitestack.com,resources=nodeconfigs/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -109,7 +114,7 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		if !isNodeReady {
 			logger.Info("node is not ready")
 			err := fmt.Errorf("node %s is not ready", r.NodeName)
-			_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusError, err.Error())
+			_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusError, err.Error(), nil)
 			return ctrl.Result{RequeueAfter: 5 * time.Minute}, err
 		}
 
@@ -117,10 +122,11 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	nodeStatus, ok := nodeConfig.Status.Nodes[r.NodeName]
 	if !ok || nodeStatus.LastGeneration != nodeConfig.Generation {
-		_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusInProgress, "")
+		_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusInProgress, "", nil)
 	}
 
 	namespacedName := nodeConfig.Namespace + "-" + nodeConfig.Name
+	readSecret := r.secretReader(ctx, nodeConfig.Namespace)
 
 	configs := []modules.Config{}
 	// START of config types handling
@@ -134,12 +140,13 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		)
 	}
 
-	if len(nodeConfig.Spec.Hosts.Hosts) != 0 {
+	if len(nodeConfig.Spec.Hosts.Hosts) != 0 || nodeConfig.Spec.Hosts.Hostname != "" {
 		configs = append(
 			configs,
 			modules.NewHostModuleConfig(
 				nodeConfig.Spec.Hosts,
 				logger.WithName("hosts"),
+				namespacedName,
 			),
 		)
 	}
@@ -154,11 +161,12 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		)
 	}
 
-	if len(nodeConfig.Spec.KernelModules.Modules) != 0 {
+	kernelModules := nodeConfig.Spec.KernelModules
+	if len(kernelModules.Modules) != 0 || len(kernelModules.Options) != 0 || len(kernelModules.Blacklist) != 0 {
 		configs = append(
 			configs,
 			modules.NewKernelModuleConfig(
-				nodeConfig.Spec.KernelModules,
+				kernelModules,
 				logger.WithName("kernel-modules"),
 				namespacedName,
 			),
@@ -182,6 +190,7 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			modules.NewSystemdUnitConfig(
 				nodeConfig.Spec.SystemdUnits,
 				logger.WithName("systemd-units"),
+				namespacedName,
 			),
 		)
 	}
@@ -189,10 +198,11 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if len(nodeConfig.Spec.Certificates.Certificates) != 0 {
 		configs = append(
 			configs,
-			modules.CertificateConfig{
-				Certificates: nodeConfig.Spec.Certificates,
-				Log:          logger.WithName("certificates"),
-			},
+			modules.NewCertificateConfig(
+				nodeConfig.Spec.Certificates,
+				logger.WithName("certificates"),
+				namespacedName,
+			),
 		)
 	}
 
@@ -210,14 +220,16 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if len(nodeConfig.Spec.Crontabs.Entries) != 0 {
 		configs = append(
 			configs,
-			modules.CrontabsConfig{
-				Crontabs: nodeConfig.Spec.Crontabs,
-				Log:      logger.WithName("crontabs"),
-			},
+			modules.NewCrontabsConfig(
+				nodeConfig.Spec.Crontabs,
+				logger.WithName("crontabs"),
+				namespacedName,
+			),
 		)
 	}
 
-	if len(nodeConfig.Spec.GrubKernelConfig.CmdlineArgs) != 0 || nodeConfig.Spec.GrubKernelConfig.KernelVersion != "" {
+	grubKernel := nodeConfig.Spec.GrubKernelConfig
+	if len(grubKernel.CmdlineArgs) != 0 || len(grubKernel.AddArgs) != 0 || len(grubKernel.RemoveArgs) != 0 || grubKernel.KernelVersion != "" {
 		configs = append(
 			configs,
 			modules.NewGrubKernelConfig(
@@ -227,6 +239,199 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			),
 		)
 	}
+
+	if len(nodeConfig.Spec.SSHAuthorizedKeys.Users) != 0 {
+		configs = append(
+			configs,
+			modules.NewSSHAuthorizedKeysConfig(
+				nodeConfig.Spec.SSHAuthorizedKeys,
+				logger.WithName("ssh-authorized-keys"),
+				namespacedName,
+				readSecret,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Sudoers.Files) != 0 {
+		configs = append(
+			configs,
+			modules.NewSudoersConfig(
+				nodeConfig.Spec.Sudoers,
+				logger.WithName("sudoers"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Files.Files) != 0 {
+		configs = append(
+			configs,
+			modules.NewFilesConfig(
+				nodeConfig.Spec.Files,
+				logger.WithName("files"),
+				readSecret,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Mounts.Mounts) != 0 {
+		configs = append(
+			configs,
+			modules.NewMountsConfig(
+				nodeConfig.Spec.Mounts,
+				logger.WithName("mounts"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.Swap.Mode != "" {
+		configs = append(
+			configs,
+			modules.NewSwapConfig(
+				nodeConfig.Spec.Swap,
+				logger.WithName("swap"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.PerformanceProfile.State != "" {
+		configs = append(
+			configs,
+			modules.NewPerformanceProfileConfig(
+				nodeConfig.Spec.PerformanceProfile,
+				logger.WithName("performance-profile"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.SysfsAttributes.Attributes) != 0 {
+		configs = append(
+			configs,
+			modules.NewSysfsAttributesConfig(
+				nodeConfig.Spec.SysfsAttributes,
+				logger.WithName("sysfs-attributes"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.UdevRules.Rules) != 0 {
+		configs = append(
+			configs,
+			modules.NewUdevRulesConfig(
+				nodeConfig.Spec.UdevRules,
+				logger.WithName("udev-rules"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.TimeSync.State != "" {
+		configs = append(
+			configs,
+			modules.NewTimeSyncConfig(
+				nodeConfig.Spec.TimeSync,
+				logger.WithName("time-sync"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Resolver.Nameservers) != 0 {
+		configs = append(
+			configs,
+			modules.NewResolverConfig(
+				nodeConfig.Spec.Resolver,
+				logger.WithName("resolver"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Netplan.Files) != 0 {
+		configs = append(
+			configs,
+			modules.NewNetplanConfig(
+				nodeConfig.Spec.Netplan,
+				logger.WithName("netplan"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.Nftables.State != "" {
+		configs = append(
+			configs,
+			modules.NewNftablesConfig(
+				nodeConfig.Spec.Nftables,
+				logger.WithName("nftables"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.Limits.State != "" {
+		configs = append(
+			configs,
+			modules.NewLimitsConfig(
+				nodeConfig.Spec.Limits,
+				logger.WithName("limits"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.Journald.State != "" {
+		configs = append(
+			configs,
+			modules.NewJournaldConfig(
+				nodeConfig.Spec.Journald,
+				logger.WithName("journald"),
+				namespacedName,
+			),
+		)
+	}
+
+	if len(nodeConfig.Spec.Logrotate.Entries) != 0 {
+		configs = append(
+			configs,
+			modules.NewLogrotateConfig(
+				nodeConfig.Spec.Logrotate,
+				logger.WithName("logrotate"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.Containerd.State != "" {
+		configs = append(
+			configs,
+			modules.NewContainerdConfig(
+				nodeConfig.Spec.Containerd,
+				logger.WithName("containerd"),
+				readSecret,
+				// containerd has its own lock, so it doesn't release the
+				// one held by a kubelet restart of the same NodeConfig
+				r.nodeCoordinator(ctx, nodeConfig.Namespace, nodeConfig.Name+"-containerd"),
+				namespacedName,
+			),
+		)
+	}
+
+	if nodeConfig.Spec.KubeletConfig.State != "" {
+		configs = append(
+			configs,
+			modules.NewKubeletConfigConfig(
+				nodeConfig.Spec.KubeletConfig,
+				logger.WithName("kubelet-config"),
+				r.nodeCoordinator(ctx, nodeConfig.Namespace, nodeConfig.Name),
+				namespacedName,
+			),
+		)
+	}
 	// END of config types handling
 
 	if !nodeConfig.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -250,14 +455,25 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Reconciliation logic
 	// Loop over all configs and call Reconcile
 	logger.Info("reconciling node")
+	moduleStatuses := []modules.ModuleStatus{}
 	for _, config := range configs {
-		if err := config.Reconcile(); err != nil {
-			_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusError, err.Error())
+		err := config.Reconcile()
+
+		// Collect the messages even if the module failed, as they usually
+		// explain the error
+		if reporter, ok := config.(modules.StatusReporter); ok {
+			statuses := reporter.Status()
+			moduleStatuses = append(moduleStatuses, statuses...)
+			r.emitWarnings(nodeConfig, statuses)
+		}
+
+		if err != nil {
+			_ = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusError, err.Error(), moduleStatuses)
 			return ctrl.Result{RequeueAfter: requeueAfterTime}, err
 		}
 	}
 
-	err = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusAvailable, "")
+	err = r.setStatus(ctx, req.NamespacedName, configurationv1beta2.NodeStatusAvailable, "", moduleStatuses)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -266,6 +482,22 @@ func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{RequeueAfter: requeueAfterTime}, nil
 }
 
+// emitWarnings emits a Warning event on the NodeConfig for each warning
+// reported by a module
+func (r *NodeConfigReconciler) emitWarnings(nodeConfig *configurationv1beta2.NodeConfig, statuses []modules.ModuleStatus) {
+	if r.Recorder == nil {
+		return
+	}
+
+	for _, status := range statuses {
+		if !status.Warning {
+			continue
+		}
+		r.Recorder.Eventf(nodeConfig, corev1.EventTypeWarning, "ModuleWarning",
+			"node %s: %s %s: %s", r.NodeName, status.Module, status.Name, status.Message)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *NodeConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	err := ctrl.NewControllerManagedBy(mgr).
@@ -335,6 +567,7 @@ func (r *NodeConfigReconciler) setStatus(
 	nodeConfigKey types.NamespacedName,
 	status configurationv1beta2.NodeStatusType,
 	statusErr string,
+	moduleStatuses []modules.ModuleStatus,
 ) error {
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		nodeConfig := &configurationv1beta2.NodeConfig{}
@@ -343,7 +576,7 @@ func (r *NodeConfigReconciler) setStatus(
 			return fmt.Errorf("failed to get nodeConfig: %w", err)
 		}
 
-		r.setNodeStatus(nodeConfig, status, statusErr)
+		r.setNodeStatus(nodeConfig, status, statusErr, moduleStatuses)
 
 		if err := r.setNodeConfigCondition(nodeConfig); err != nil {
 			return fmt.Errorf("failed to set nodeConfig condition: %w", err)
@@ -361,6 +594,7 @@ func (r *NodeConfigReconciler) setNodeStatus(
 	nodeConfig *configurationv1beta2.NodeConfig,
 	status configurationv1beta2.NodeStatusType,
 	statusErr string,
+	moduleStatuses []modules.ModuleStatus,
 ) {
 	if nodeConfig.Status.Nodes == nil {
 		nodeConfig.Status.Nodes = make(map[string]configurationv1beta2.NodeStatus)
@@ -373,11 +607,13 @@ func (r *NodeConfigReconciler) setNodeStatus(
 			Status:         status,
 			Error:          statusErr,
 			LastGeneration: lastGeneration,
+			Modules:        moduleStatuses,
 		}
 	} else {
 		nodeStatus.Status = status
 		nodeStatus.Error = statusErr
 		nodeStatus.LastGeneration = lastGeneration
+		nodeStatus.Modules = moduleStatuses
 	}
 
 	nodeConfig.Status.Nodes[r.NodeName] = nodeStatus
@@ -466,6 +702,25 @@ func (r *NodeConfigReconciler) checkNodeBySelector(
 	return true, nil
 }
 
+// secretReader returns a function that reads keys from the secrets in the
+// NodeConfig's namespace. Secrets are excluded from the cache, so they're read
+// from the API server and the operator only needs to get them
+func (r *NodeConfigReconciler) secretReader(ctx context.Context, namespace string) modules.SecretReader {
+	return func(ref modules.SecretKeyRef) (string, error) {
+		secret := &corev1.Secret{}
+		key := ktypes.NamespacedName{Namespace: namespace, Name: ref.Name}
+		if err := r.Get(ctx, key, secret); err != nil {
+			return "", fmt.Errorf("failed to get secret %s: %w", ref.Name, err)
+		}
+
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Name)
+		}
+		return string(value), nil
+	}
+}
+
 func (r NodeConfigReconciler) checkNodeStatus(ctx context.Context) (bool, error) {
 	node := &corev1.Node{}
 	if err := r.Get(ctx, ktypes.NamespacedName{Name: r.NodeName}, node); err != nil {
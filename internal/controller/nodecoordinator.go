@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// leaseDuration is the time after which a lock held by a node that stopped
+// renewing it, e.g. because it was deleted, can be taken by another node
+const leaseDuration = 30 * time.Minute
+
+// nodeCoordinator implements modules.NodeCoordinator with a Lease in the
+// namespace of the NodeConfig, held by the node that is running the
+// disruptive operation
+type nodeCoordinator struct {
+	client.Client
+	ctx      context.Context
+	lease    ktypes.NamespacedName
+	nodeName string
+}
+
+func (r *NodeConfigReconciler) nodeCoordinator(ctx context.Context, namespace, name string) *nodeCoordinator {
+	return &nodeCoordinator{
+		Client:   r.Client,
+		ctx:      ctx,
+		lease:    ktypes.NamespacedName{Namespace: namespace, Name: "nco-lock-" + name},
+		nodeName: r.NodeName,
+	}
+}
+
+func (c *nodeCoordinator) HoldsLock() (bool, error) {
+	lease := &coordinationv1.Lease{}
+	err := c.Get(c.ctx, c.lease, lease)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease: %w", err)
+	}
+
+	return ptr.Deref(lease.Spec.HolderIdentity, "") == c.nodeName, nil
+}
+
+func (c *nodeCoordinator) AcquireLock() (bool, error) {
+	now := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{}
+	err := c.Get(c.ctx, c.lease, lease)
+	if kerrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: c.lease.Namespace, Name: c.lease.Name},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(c.nodeName),
+				LeaseDurationSeconds: ptr.To(int32(leaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err := c.Create(c.ctx, lease); err != nil {
+			if kerrors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to create lease: %w", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease: %w", err)
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder != c.nodeName && holder != "" && !leaseExpired(lease) {
+		return false, nil
+	}
+
+	if holder != c.nodeName {
+		lease.Spec.HolderIdentity = ptr.To(c.nodeName)
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(leaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+
+	// The update fails with a conflict if another node took the lease since
+	// it was read
+	if err := c.Update(c.ctx, lease); err != nil {
+		if kerrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update lease: %w", err)
+	}
+	return true, nil
+}
+
+func (c *nodeCoordinator) ReleaseLock() error {
+	lease := &coordinationv1.Lease{}
+	err := c.Get(c.ctx, c.lease, lease)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lease: %w", err)
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != c.nodeName {
+		return nil
+	}
+
+	if err := c.Delete(c.ctx, lease); err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete lease: %w", err)
+	}
+	return nil
+}
+
+// NodeReady checks the Ready condition of the node and that the kubelet
+// renewed its node lease after the given time, as the condition isn't
+// updated when the kubelet restarts quickly
+func (c *nodeCoordinator) NodeReady(since time.Time) (bool, error) {
+	node := &corev1.Node{}
+	if err := c.Get(c.ctx, ktypes.NamespacedName{Name: c.nodeName}, node); err != nil {
+		return false, err
+	}
+	if !isNodeReady(node) {
+		return false, nil
+	}
+
+	nodeLease := &coordinationv1.Lease{}
+	err := c.Get(c.ctx, ktypes.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: c.nodeName}, nodeLease)
+	if kerrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return nodeLease.Spec.RenewTime != nil && nodeLease.Spec.RenewTime.After(since), nil
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return time.Now().After(lease.Spec.RenewTime.Add(duration))
+}
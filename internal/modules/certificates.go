@@ -1,10 +1,16 @@
 package modules
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -12,11 +18,24 @@ import (
 const (
 	certPath       = "/host/usr/local/share/ca-certificates/"
 	caCertFilePath = "/host/etc/ssl/certs/ca-certificates.crt"
+
+	// Paths used by RHEL based hosts
+	caTrustAnchorsPath = "/host/etc/pki/ca-trust/source/anchors/"
+	caTrustBundlePath  = "/host/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"
+
+	// certificatesStatePath keeps the files installed by each NodeConfig
+	certificatesStatePath = "/host/etc/nco"
 )
 
 // +kubebuilder:object:generate=true
 type Certificates struct {
 	Certificates []Certificate `json:"certificates,omitempty"`
+	// Days before the expiration of a certificate to report a warning
+	// (default: 30)
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=30
+	// +optional
+	ExpiryWarningDays *int `json:"expiryWarningDays,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 }
@@ -36,7 +55,65 @@ type Certificate struct {
 
 type CertificateConfig struct {
 	Certificates
-	Log logr.Logger
+	*statusRecorder
+	Log       logr.Logger
+	stateFile string
+}
+
+func NewCertificateConfig(certificates Certificates, logger logr.Logger, name string) CertificateConfig {
+	return CertificateConfig{
+		Certificates:   certificates,
+		statusRecorder: newStatusRecorder("certificates"),
+		Log:            logger,
+		stateFile:      fmt.Sprintf("%s/certificates-%s.list", certificatesStatePath, name),
+	}
+}
+
+// caTrust describes where the CA certificates are installed on the host and
+// how the bundle is generated
+type caTrust struct {
+	directory  string
+	bundlePath string
+	updateCmd  []string
+}
+
+// detectCATrust returns the CA trust paths of the host. RHEL based hosts use
+// update-ca-trust, the rest use update-ca-certificates
+func detectCATrust() (caTrust, error) {
+	isRHEL, err := checkFileExists("/host/usr/bin/update-ca-trust")
+	if err != nil {
+		return caTrust{}, fmt.Errorf("failed to detect CA trust tool: %w", err)
+	}
+	if isRHEL {
+		return caTrust{
+			directory:  caTrustAnchorsPath,
+			bundlePath: caTrustBundlePath,
+			updateCmd:  []string{"update-ca-trust", "extract"},
+		}, nil
+	}
+
+	return caTrust{
+		directory:  certPath,
+		bundlePath: caCertFilePath,
+		updateCmd:  []string{"update-ca-certificates"},
+	}, nil
+}
+
+// filePath returns the path of the certificate. update-ca-certificates only
+// reads files with the .crt extension
+func (t caTrust) filePath(fileName string) string {
+	if t.directory == certPath && !strings.HasSuffix(fileName, ".crt") {
+		fileName += ".crt"
+	}
+	return t.directory + fileName
+}
+
+func (t caTrust) update() error {
+	output, err := execChroot(t.updateCmd...)
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %s", t.updateCmd[0], strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
 func (c CertificateConfig) Reconcile() error {
@@ -68,71 +145,233 @@ func (c CertificateConfig) Reconcile() error {
 }
 
 func (c CertificateConfig) applyModule() error {
+	trust, err := detectCATrust()
+	if err != nil {
+		return err
+	}
+
+	bundle, err := readBundleFingerprints(trust.bundlePath)
+	if err != nil {
+		return err
+	}
+
 	modified := false
+	installed := []string{}
 	for _, cert := range c.Certificates.Certificates {
-		isCurrent, err := checkCurrentConfig(cert.Content)
+		parsed, err := parseCertificates(cert.Content)
+		if err != nil {
+			return fmt.Errorf("invalid certificate %s: %w", cert.FileName, err)
+		}
+		c.recordCertificates(cert.FileName, parsed)
+
+		filePath := trust.filePath(cert.FileName)
+		installed = append(installed, filePath)
+
+		isCurrent, err := checkFileContents(filePath, cert.Content)
 		if err != nil {
 			return fmt.Errorf("failed to check current config: %w", err)
 		}
 
-		if isCurrent {
-			// do nothing
+		if !isCurrent {
+			if err := writeFile(filePath, cert.Content); err != nil {
+				return fmt.Errorf("failed to write file: %w", err)
+			}
+			modified = true
 			continue
 		}
-		err = writeFile(certPath+cert.FileName, cert.Content)
 
-		if err != nil {
-			return fmt.Errorf("failed to write file: %w", err)
+		// The bundle is generated again if a previous update failed
+		for _, certificate := range parsed {
+			if !bundle[sha256.Sum256(certificate.Raw)] {
+				modified = true
+			}
 		}
-		modified = true
 	}
-	if modified {
-		_, err := execChroot("update-ca-certificates")
 
+	// Remove the certificates deleted or renamed in the NodeConfig
+	previous, err := c.readInstalledFiles()
+	if err != nil {
+		return err
+	}
+	for _, filePath := range previous {
+		if slices.Contains(installed, filePath) {
+			continue
+		}
+		exists, err := checkFileExists(filePath)
 		if err != nil {
-			return fmt.Errorf("failed to run update-ca-certificates: %w", err)
+			return fmt.Errorf("failed to check file: %w", err)
+		}
+		if exists {
+			c.Log.Info("removing certificate", "path", filePath)
+			if err := deleteFileIfExists(filePath); err != nil {
+				return fmt.Errorf("failed to delete file: %w", err)
+			}
+			modified = true
 		}
 	}
 
-	return nil
+	if modified {
+		if err := trust.update(); err != nil {
+			return err
+		}
+	}
+
+	return c.writeInstalledFiles(installed)
 }
 
 func (c CertificateConfig) removeModule() error {
-	changed := false
+	trust, err := detectCATrust()
+	if err != nil {
+		return err
+	}
 
+	files, err := c.readInstalledFiles()
+	if err != nil {
+		return err
+	}
 	for _, cert := range c.Certificates.Certificates {
-		err := os.Remove(certPath + cert.FileName)
+		files = append(files, trust.filePath(cert.FileName))
+	}
 
+	changed := false
+	for _, filePath := range files {
+		exists, err := checkFileExists(filePath)
 		if err != nil {
-			if !errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("failed to delete file: %w", err)
-			} else {
-				continue
-			}
+			return fmt.Errorf("failed to check file: %w", err)
+		}
+		if !exists {
+			continue
+		}
+		if err := deleteFileIfExists(filePath); err != nil {
+			return fmt.Errorf("failed to delete file: %w", err)
 		}
 		changed = true
 	}
-	if !changed {
-		// Skip updating ca certificates if no files were deleted.
-		return nil
+
+	if changed {
+		if err := trust.update(); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteFileIfExists(c.stateFile); err != nil {
+		return fmt.Errorf("failed to delete state file: %w", err)
+	}
+	return nil
+}
+
+// recordCertificates reports the subject, issuer and expiration of each
+// certificate, with a warning if it expires soon
+func (c CertificateConfig) recordCertificates(fileName string, certificates []*x509.Certificate) {
+	warningDays := 30
+	if c.ExpiryWarningDays != nil {
+		warningDays = *c.ExpiryWarningDays
+	}
+
+	for _, certificate := range certificates {
+		message, expiresSoon := certificateStatusMessage(certificate, time.Now(), warningDays)
+		if expiresSoon {
+			c.recordWarning(fileName, message)
+		} else {
+			c.record(fileName, message)
+		}
+	}
+}
+
+func (c CertificateConfig) readInstalledFiles() ([]string, error) {
+	content, err := os.ReadFile(c.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
 	}
-	_, err := execChroot("update-ca-certificates")
+
+	return strings.Fields(string(content)), nil
+}
+
+func (c CertificateConfig) writeInstalledFiles(files []string) error {
+	content := strings.Join(files, "\n") + "\n"
+	isCurrent, err := checkFileContents(c.stateFile, content)
 	if err != nil {
-		return fmt.Errorf("failed to run update-ca-certificates: %w", err)
+		return fmt.Errorf("failed to check state file: %w", err)
+	}
+	if isCurrent {
+		return nil
 	}
 
+	if err := writeFile(c.stateFile, content); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
 	return nil
 }
 
-func checkCurrentConfig(content string) (bool, error) {
-	doesFileContain, err := checkFileContains(caCertFilePath, content)
+// parseCertificates parses all the certificates of a PEM file
+func parseCertificates(content string) ([]*x509.Certificate, error) {
+	certificates := []*x509.Certificate{}
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %s", block.Type)
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, errors.New("unexpected data after the certificates")
+	}
+
+	return certificates, nil
+}
+
+// readBundleFingerprints returns the SHA-256 fingerprints of the certificates
+// in the CA bundle of the host
+func readBundleFingerprints(bundlePath string) (map[[32]byte]bool, error) {
+	fingerprints := map[[32]byte]bool{}
+	content, err := os.ReadFile(bundlePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fingerprints, nil
+	}
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
 	}
 
-	if !doesFileContain {
-		return false, nil
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		fingerprints[sha256.Sum256(block.Bytes)] = true
 	}
 
-	return true, nil
+	return fingerprints, nil
+}
+
+// certificateStatusMessage returns the status message of a certificate and
+// whether it expires within the warning days
+func certificateStatusMessage(certificate *x509.Certificate, now time.Time, warningDays int) (string, bool) {
+	message := fmt.Sprintf("subject=%s, issuer=%s, notAfter=%s",
+		certificate.Subject.String(), certificate.Issuer.String(), certificate.NotAfter.UTC().Format(time.RFC3339))
+
+	if now.After(certificate.NotAfter) {
+		return "certificate expired: " + message, true
+	}
+	if certificate.NotAfter.Before(now.AddDate(0, 0, warningDays)) {
+		return "certificate expires soon: " + message, true
+	}
+	return message, false
 }
@@ -0,0 +1,734 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	containerdConfigPath = "/etc/containerd/config.toml"
+	containerdCertsPath  = "/etc/containerd/certs.d"
+	containerdConfDPath  = "/etc/containerd/conf.d"
+
+	// Suffix of the backup of a hosts.toml not managed by the operator
+	containerdBackupSuffix = ".nco-backup"
+
+	// State files shared by all the NodeConfigs, as containerd is restarted
+	// for all of them
+	containerdLastRestartPath    = "/host/etc/nco/containerd-last-restart"
+	containerdPendingRestartPath = "/host/etc/nco/containerd-restart-pending"
+)
+
+// +kubebuilder:object:generate=true
+// Containerd defines the registries and configuration drop-ins of containerd
+type Containerd struct {
+	// Registries configured in /etc/containerd/certs.d
+	// +optional
+	Registries []ContainerdRegistry `json:"registries,omitempty"`
+	// Configuration drop-ins written to /etc/containerd/conf.d. They're only
+	// loaded if config.toml imports that directory
+	// +optional
+	ConfigDropIns []ContainerdDropIn `json:"configDropIns,omitempty"`
+	// Restart containerd when the drop-ins change
+	// +optional
+	Restart *ContainerdRestart `json:"restart,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (c Containerd) IsPresent() bool {
+	if (len(c.Registries) != 0 || len(c.ConfigDropIns) != 0) && c.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type ContainerdRegistry struct {
+	// Registry host (e.g. docker.io or registry.example.com:5000), or
+	// _default for all the registries without a configuration
+	// +kubebuilder:validation:Pattern=`^(_default|[A-Za-z0-9.-]+(:[0-9]+)?)$`
+	Name string `json:"name"`
+	// URL of the upstream registry (default: https://<name>)
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	Server string `json:"server,omitempty"`
+	// Skip the verification of the upstream registry's certificate
+	// +optional
+	SkipVerify bool `json:"skipVerify,omitempty"`
+	// CA of the upstream registry
+	// +optional
+	CA *ContainerdCA `json:"ca,omitempty"`
+	// Mirrors tried in order before the upstream registry
+	// +optional
+	Mirrors []ContainerdMirror `json:"mirrors,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type ContainerdMirror struct {
+	// URL of the mirror
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+	// Operations allowed on the mirror (default: pull and resolve)
+	// +optional
+	Capabilities []ContainerdCapability `json:"capabilities,omitempty"`
+	// Skip the verification of the mirror's certificate
+	// +optional
+	SkipVerify bool `json:"skipVerify,omitempty"`
+	// CA of the mirror
+	// +optional
+	CA *ContainerdCA `json:"ca,omitempty"`
+	// Use the path of the URL as the API root, for mirrors that don't serve
+	// the API under /v2
+	// +optional
+	OverridePath bool `json:"overridePath,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=pull;resolve;push
+type ContainerdCapability string
+
+// +kubebuilder:object:generate=true
+type ContainerdCA struct {
+	// File name of a certificate installed by the certificates module
+	// +optional
+	Certificate string `json:"certificate,omitempty"`
+	// Secret key with the CA in PEM format
+	// +optional
+	SecretRef *SecretKeyRef `json:"secretRef,omitempty"`
+}
+
+type ContainerdDropIn struct {
+	// Name of the drop-in. The file is named nco-<NodeConfig>-<name>.toml
+	Name string `json:"name"`
+	// Configuration in TOML
+	Content string `json:"content"`
+}
+
+// +kubebuilder:object:generate=true
+type ContainerdRestart struct {
+	// Restart containerd when the drop-ins change
+	Enabled bool `json:"enabled,omitempty"`
+	// Minimum seconds between two restarts of containerd. Restarts are
+	// postponed until the interval has passed (default: 600)
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=600
+	// +optional
+	MinInterval *int `json:"minInterval,omitempty"`
+}
+
+type ContainerdConfig struct {
+	Containerd
+	*statusRecorder
+	logger       logr.Logger
+	readSecret   SecretReader
+	coordinator  NodeCoordinator
+	resourceName string
+	ownerMarker  string
+}
+
+func NewContainerdConfig(containerd Containerd, logger logr.Logger, readSecret SecretReader, coordinator NodeCoordinator, name string) ContainerdConfig {
+	return ContainerdConfig{
+		Containerd:     containerd,
+		statusRecorder: newStatusRecorder("containerd"),
+		logger:         logger,
+		readSecret:     readSecret,
+		coordinator:    coordinator,
+		resourceName:   name,
+		ownerMarker:    fmt.Sprintf("# NCO OWNER %s", name),
+	}
+}
+
+func (c ContainerdConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		c.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"containerd", nil}
+	if c.State == "present" {
+		c.logger.V(1).Info("applying module")
+		if err := c.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		c.logger.V(1).Info("module applied")
+	} else if c.State == "absent" {
+		c.logger.V(1).Info("removing module")
+		if err := c.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		c.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (c ContainerdConfig) applyModule() error {
+	config, err := os.ReadFile("/host" + containerdConfigPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read containerd config: %w", err)
+	}
+
+	if len(c.Registries) != 0 && !strings.Contains(string(config), containerdCertsPath) {
+		c.record("", fmt.Sprintf("config_path of the registry plugin is not set to %s, the registries are not used", containerdCertsPath))
+	}
+
+	desiredRegistries := map[string]bool{}
+	for _, registry := range c.Registries {
+		if err := c.applyRegistry(registry); err != nil {
+			return fmt.Errorf("failed to configure registry %s: %w", registry.Name, err)
+		}
+		desiredRegistries[registry.Name] = true
+	}
+	if err := c.removeRegistries(desiredRegistries); err != nil {
+		return err
+	}
+
+	changed, err := c.applyDropIns(containerdImportsDropIns(string(config)))
+	if err != nil {
+		return err
+	}
+
+	return c.restartIfNeeded(changed)
+}
+
+func (c ContainerdConfig) removeModule() error {
+	if err := c.removeRegistries(map[string]bool{}); err != nil {
+		return err
+	}
+
+	config, err := os.ReadFile("/host" + containerdConfigPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read containerd config: %w", err)
+	}
+
+	removed, err := c.removeDropIns(map[string]bool{})
+	if err != nil {
+		return err
+	}
+
+	return c.restartIfNeeded(removed && containerdImportsDropIns(string(config)))
+}
+
+// applyRegistry writes the hosts.toml file of the registry, and the CAs it
+// references. containerd reads these files on each pull, so it doesn't need
+// to be restarted
+func (c ContainerdConfig) applyRegistry(registry ContainerdRegistry) error {
+	dir := fmt.Sprintf("%s/%s", containerdCertsPath, registry.Name)
+	hostsPath := dir + "/hosts.toml"
+
+	owner, err := c.fileOwner("/host" + hostsPath)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != c.ownerMarker {
+		return fmt.Errorf("%s is managed by another NodeConfig", hostsPath)
+	}
+
+	server := registry.Server
+	if server == "" && registry.Name == "docker.io" {
+		server = "https://registry-1.docker.io"
+	} else if server == "" && registry.Name != "_default" {
+		server = "https://" + registry.Name
+	}
+
+	serverCA, err := c.resolveCA(dir, "server", registry.CA)
+	if err != nil {
+		return err
+	}
+	cas := []string{serverCA}
+
+	hosts := []containerdHost{}
+	for i, mirror := range registry.Mirrors {
+		ca, err := c.resolveCA(dir, fmt.Sprintf("mirror-%d", i), mirror.CA)
+		if err != nil {
+			return err
+		}
+		cas = append(cas, ca)
+
+		capabilities := []string{}
+		for _, capability := range mirror.Capabilities {
+			capabilities = append(capabilities, string(capability))
+		}
+		if len(capabilities) == 0 {
+			capabilities = []string{"pull", "resolve"}
+		}
+
+		hosts = append(hosts, containerdHost{
+			url:          mirror.URL,
+			capabilities: capabilities,
+			skipVerify:   mirror.SkipVerify,
+			ca:           ca,
+			overridePath: mirror.OverridePath,
+		})
+	}
+
+	content := renderHostsToml(c.ownerMarker, containerdHost{
+		url:        server,
+		skipVerify: registry.SkipVerify,
+		ca:         serverCA,
+	}, hosts)
+
+	isCurrent, err := checkFileContents("/host"+hostsPath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", hostsPath, err)
+	}
+
+	if !isCurrent {
+		// A hosts.toml not managed by the operator is kept as a backup and
+		// restored when the registry is removed
+		if owner == "" {
+			backedUp, err := backupHostsToml("/host" + hostsPath)
+			if err != nil {
+				return err
+			}
+			if backedUp {
+				c.logger.Info("hosts.toml not managed by the operator backed up", "path", hostsPath+containerdBackupSuffix)
+			}
+		}
+
+		if err := writeFileAtomic("/host"+hostsPath, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hostsPath, err)
+		}
+		c.logger.Info("registry configuration updated", "registry", registry.Name)
+	}
+
+	// CAs of mirrors removed from the list are no longer referenced
+	return removeStaleCAs("/host"+dir, cas)
+}
+
+// backupHostsToml renames a hosts.toml to its backup path, unless there's
+// already a backup
+func backupHostsToml(path string) (bool, error) {
+	if exists, err := checkFileExists(path); err != nil || !exists {
+		return false, err
+	}
+	if exists, err := checkFileExists(path + containerdBackupSuffix); err != nil || exists {
+		return false, err
+	}
+
+	if err := os.Rename(path, path+containerdBackupSuffix); err != nil {
+		return false, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// restoreHostsToml renames the backup of a hosts.toml to its original path
+func restoreHostsToml(path string) (bool, error) {
+	exists, err := checkFileExists(path + containerdBackupSuffix)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if err := os.Rename(path+containerdBackupSuffix, path); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// removeStaleCAs deletes the CA files written by the operator in the
+// directory of a registry that are not in the desired list
+func removeStaleCAs(dir string, desired []string) error {
+	files, err := filepath.Glob(dir + "/nco-*.crt")
+	if err != nil {
+		return fmt.Errorf("failed to list CA files: %w", err)
+	}
+
+	for _, path := range files {
+		if slices.Contains(desired, strings.TrimPrefix(path, "/host")) {
+			continue
+		}
+		if err := deleteFileIfExists(path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveCA returns the path of the CA used by containerd. CAs from secrets
+// are written next to hosts.toml
+func (c ContainerdConfig) resolveCA(dir, name string, ca *ContainerdCA) (string, error) {
+	if ca == nil {
+		return "", nil
+	}
+
+	if ca.SecretRef != nil {
+		content, err := c.readSecret(*ca.SecretRef)
+		if err != nil {
+			return "", err
+		}
+		if _, err := parseCertificates(content); err != nil {
+			return "", fmt.Errorf("invalid CA in secret %s: %w", ca.SecretRef.Name, err)
+		}
+
+		path := fmt.Sprintf("%s/nco-%s.crt", dir, name)
+		isCurrent, err := checkFileContents("/host"+path, content)
+		if err != nil {
+			return "", fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		if !isCurrent {
+			if err := writeFileAtomic("/host"+path, content, 0644); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+		return path, nil
+	}
+
+	if ca.Certificate != "" {
+		trust, err := detectCATrust()
+		if err != nil {
+			return "", err
+		}
+		path := trust.filePath(ca.Certificate)
+		exists, err := checkFileExists(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to check certificate: %w", err)
+		}
+		if !exists {
+			return "", fmt.Errorf("certificate %s is not installed", ca.Certificate)
+		}
+		return strings.TrimPrefix(path, "/host"), nil
+	}
+
+	return "", nil
+}
+
+// removeRegistries deletes the hosts.toml files of this NodeConfig that are
+// not in the desired registries, with the CAs written for them
+func (c ContainerdConfig) removeRegistries(desired map[string]bool) error {
+	files, err := filepath.Glob("/host" + containerdCertsPath + "/*/hosts.toml")
+	if err != nil {
+		return fmt.Errorf("failed to list registries: %w", err)
+	}
+
+	for _, hostsPath := range files {
+		dir := filepath.Dir(hostsPath)
+		if desired[filepath.Base(dir)] {
+			continue
+		}
+
+		owner, err := c.fileOwner(hostsPath)
+		if err != nil {
+			return err
+		}
+		if owner != c.ownerMarker {
+			continue
+		}
+
+		c.logger.Info("removing registry configuration", "registry", filepath.Base(dir))
+		caFiles, err := filepath.Glob(dir + "/nco-*.crt")
+		if err != nil {
+			return fmt.Errorf("failed to list CA files: %w", err)
+		}
+		for _, path := range append(caFiles, hostsPath) {
+			if err := deleteFileIfExists(path); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", path, err)
+			}
+		}
+		restored, err := restoreHostsToml(hostsPath)
+		if err != nil {
+			return err
+		}
+		if restored {
+			c.logger.Info("restored hosts.toml not managed by the operator", "path", hostsPath)
+		}
+		// the directory is only deleted if it's empty
+		_ = os.Remove(dir)
+	}
+
+	return nil
+}
+
+// applyDropIns writes the drop-ins and returns true if any of them changed.
+// When config.toml imports them, the merged configuration is checked with
+// containerd config dump and the previous files are restored if it fails
+func (c ContainerdConfig) applyDropIns(imported bool) (bool, error) {
+	if len(c.ConfigDropIns) != 0 && !imported {
+		c.record("", fmt.Sprintf("%s doesn't import %s/*.toml, the drop-ins are not loaded", containerdConfigPath, containerdConfDPath))
+	}
+
+	desired := map[string]bool{}
+	backup := map[string]string{}
+	for _, dropIn := range c.ConfigDropIns {
+		path := fmt.Sprintf("/host%s/nco-%s-%s.toml", containerdConfDPath, c.resourceName, sanitizeFileName(dropIn.Name))
+		desired[path] = true
+		content := c.ownerMarker + "\n" + strings.TrimRight(dropIn.Content, "\n") + "\n"
+
+		previous, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if string(previous) == content {
+			continue
+		}
+
+		backup[path] = string(previous)
+		if err := writeFileAtomic(path, content, 0644); err != nil {
+			return false, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	if len(backup) != 0 && imported {
+		if output, err := execChroot("containerd", "config", "dump"); err != nil {
+			for path, content := range backup {
+				var restoreErr error
+				if content == "" {
+					restoreErr = deleteFileIfExists(path)
+				} else {
+					restoreErr = writeFileAtomic(path, content, 0644)
+				}
+				if restoreErr != nil {
+					c.logger.Error(restoreErr, "failed to restore drop-in", "path", path)
+				}
+			}
+			return false, fmt.Errorf("invalid containerd configuration: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	removed, err := c.removeDropIns(desired)
+	if err != nil {
+		return false, err
+	}
+
+	return (len(backup) != 0 || removed) && imported, nil
+}
+
+// removeDropIns deletes the drop-ins of this NodeConfig that are not desired
+// and returns true if any was deleted
+func (c ContainerdConfig) removeDropIns(desired map[string]bool) (bool, error) {
+	files, err := filepath.Glob("/host" + containerdConfDPath + "/nco-*.toml")
+	if err != nil {
+		return false, fmt.Errorf("failed to list drop-ins: %w", err)
+	}
+
+	removed := false
+	for _, path := range files {
+		if desired[path] {
+			continue
+		}
+
+		owner, err := c.fileOwner(path)
+		if err != nil {
+			return false, err
+		}
+		if owner != c.ownerMarker {
+			continue
+		}
+
+		if err := deleteFileIfExists(path); err != nil {
+			return false, fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+		removed = true
+	}
+
+	return removed, nil
+}
+
+// restartIfNeeded restarts containerd if the configuration changed or a
+// previous restart was postponed. Restarts are rate limited and only done if
+// they keep the containers running. Only one node of the NodeConfig restarts
+// containerd at a time: the lock is released once it's active again, so a
+// containerd that doesn't recover stops the rollout
+func (c ContainerdConfig) restartIfNeeded(changed bool) error {
+	pending, err := containerdRestartPending()
+	if err != nil {
+		return err
+	}
+	if !changed && !pending {
+		// containerd was restarted by someone else after a failed restart
+		holdsLock, err := c.coordinator.HoldsLock()
+		if err != nil || !holdsLock {
+			return err
+		}
+		return c.coordinator.ReleaseLock()
+	}
+
+	if err := writeFile(containerdPendingRestartPath, ""); err != nil {
+		return fmt.Errorf("failed to mark pending restart: %w", err)
+	}
+
+	if c.Restart == nil || !c.Restart.Enabled {
+		c.record("", "containerd must be restarted to apply the configuration")
+		return nil
+	}
+
+	// With other kill modes, restarting containerd also kills the containers
+	output, err := execChroot("systemctl", "show", "-p", "KillMode", "--value", "containerd")
+	if err != nil {
+		return fmt.Errorf("failed to check containerd kill mode: %s", strings.TrimSpace(string(output)))
+	}
+	if killMode := strings.TrimSpace(string(output)); killMode != "process" {
+		c.recordWarning("", fmt.Sprintf("containerd is not restarted as its KillMode is %s, restarting it would stop the containers", killMode))
+		return nil
+	}
+
+	minInterval := 600
+	if c.Restart.MinInterval != nil {
+		minInterval = *c.Restart.MinInterval
+	}
+	lastRestart, err := readContainerdLastRestart()
+	if err != nil {
+		return err
+	}
+	if next := lastRestart.Add(time.Duration(minInterval) * time.Second); time.Now().Before(next) {
+		c.record("", fmt.Sprintf("containerd restart postponed until %s", next.UTC().Format(time.RFC3339)))
+		return nil
+	}
+
+	acquired, err := c.coordinator.AcquireLock()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		c.record("", "waiting for another node to restart containerd")
+		return nil
+	}
+
+	c.logger.Info("restarting containerd")
+	if output, err := execChroot("systemctl", "restart", "containerd"); err != nil {
+		return fmt.Errorf("failed to restart containerd: %s", strings.TrimSpace(string(output)))
+	}
+	if err := writeFile(containerdLastRestartPath, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return fmt.Errorf("failed to save restart time: %w", err)
+	}
+	if err := waitForUnit("containerd", time.Minute); err != nil {
+		return err
+	}
+
+	if err := deleteFileIfExists(containerdPendingRestartPath); err != nil {
+		return fmt.Errorf("failed to clear pending restart: %w", err)
+	}
+	c.record("", "containerd restarted")
+	return c.coordinator.ReleaseLock()
+}
+
+// fileOwner returns the owner marker of a file managed by the operator, or an
+// empty string if the file doesn't exist or has no marker
+func (c ContainerdConfig) fileOwner(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	if strings.HasPrefix(firstLine, "# NCO OWNER ") {
+		return firstLine, nil
+	}
+	return "", nil
+}
+
+// containerdRestartPending checks if a restart was postponed and containerd
+// wasn't restarted since then, e.g. by an administrator
+func containerdRestartPending() (bool, error) {
+	info, err := os.Stat(containerdPendingRestartPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check pending restart: %w", err)
+	}
+
+	output, err := execChroot("systemctl", "show", "--timestamp=unix", "-p", "ActiveEnterTimestamp", "--value", "containerd")
+	if err != nil {
+		// older systemd versions don't support --timestamp
+		return true, nil
+	}
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(string(output)), "@"), 10, 64)
+	if err != nil || time.Unix(seconds, 0).Before(info.ModTime()) {
+		return true, nil
+	}
+
+	if err := deleteFileIfExists(containerdPendingRestartPath); err != nil {
+		return false, fmt.Errorf("failed to clear pending restart: %w", err)
+	}
+	return false, nil
+}
+
+func readContainerdLastRestart() (time.Time, error) {
+	content, err := os.ReadFile(containerdLastRestartPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read last restart time: %w", err)
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// containerdImportsDropIns checks if the imports of config.toml include the
+// drop-ins directory
+func containerdImportsDropIns(config string) bool {
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "imports") && strings.Contains(line, containerdConfDPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type containerdHost struct {
+	url          string
+	capabilities []string
+	skipVerify   bool
+	ca           string
+	overridePath bool
+}
+
+// renderHostsToml returns the hosts.toml file of a registry. The upstream
+// server is configured at the top level and the mirrors as host tables
+func renderHostsToml(ownerMarker string, server containerdHost, mirrors []containerdHost) string {
+	lines := []string{ownerMarker, overrideHeader}
+	if server.url != "" {
+		lines = append(lines, "server = "+strconv.Quote(server.url))
+	}
+	if server.skipVerify {
+		lines = append(lines, "skip_verify = true")
+	}
+	if server.ca != "" {
+		lines = append(lines, "ca = "+strconv.Quote(server.ca))
+	}
+
+	for _, mirror := range mirrors {
+		lines = append(lines, "", fmt.Sprintf("[host.%s]", strconv.Quote(mirror.url)))
+
+		capabilities := slices.Clone(mirror.capabilities)
+		for i, capability := range capabilities {
+			capabilities[i] = strconv.Quote(capability)
+		}
+		lines = append(lines, fmt.Sprintf("  capabilities = [%s]", strings.Join(capabilities, ", ")))
+
+		if mirror.skipVerify {
+			lines = append(lines, "  skip_verify = true")
+		}
+		if mirror.ca != "" {
+			lines = append(lines, "  ca = "+strconv.Quote(mirror.ca))
+		}
+		if mirror.overridePath {
+			lines = append(lines, "  override_path = true")
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRenderHostsToml(t *testing.T) {
+	content := renderHostsToml("# NCO OWNER default-sample", containerdHost{
+		url: "https://registry-1.docker.io",
+	}, []containerdHost{
+		{
+			url:          "https://mirror.example.com",
+			capabilities: []string{"pull", "resolve"},
+			ca:           "/etc/containerd/certs.d/docker.io/nco-mirror-0.crt",
+		},
+		{
+			url:          "http://10.0.0.5:5000/v2/dockerhub",
+			capabilities: []string{"pull"},
+			skipVerify:   true,
+			overridePath: true,
+		},
+	})
+
+	expected := "# NCO OWNER default-sample\n" + overrideHeader + `
+server = "https://registry-1.docker.io"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/containerd/certs.d/docker.io/nco-mirror-0.crt"
+
+[host."http://10.0.0.5:5000/v2/dockerhub"]
+  capabilities = ["pull"]
+  skip_verify = true
+  override_path = true
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestContainerdImportsDropIns(t *testing.T) {
+	tests := map[string]bool{
+		"version = 2\nimports = [\"/etc/containerd/conf.d/*.toml\"]\n": true,
+		"version = 2\n[plugins]\n":                                     false,
+		"# imports = [\"/etc/containerd/conf.d/*.toml\"]\n":            false,
+	}
+
+	for config, expected := range tests {
+		if imported := containerdImportsDropIns(config); imported != expected {
+			t.Errorf("containerdImportsDropIns(%q) = %v", config, imported)
+		}
+	}
+}
+
+func TestHostsTomlBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/hosts.toml"
+	if err := os.WriteFile(path, []byte("server = \"https://example.com\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if backedUp, err := backupHostsToml(path); err != nil || !backedUp {
+		t.Fatalf("backupHostsToml = %v, %v, want true", backedUp, err)
+	}
+	if err := os.WriteFile(path, []byte("# NCO OWNER default-sample\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the original file is never replaced by a managed one
+	if backedUp, err := backupHostsToml(path); err != nil || backedUp {
+		t.Fatalf("second backupHostsToml = %v, %v, want false", backedUp, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := restoreHostsToml(path); err != nil || !restored {
+		t.Fatalf("restoreHostsToml = %v, %v, want true", restored, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "server = \"https://example.com\"\n" {
+		t.Errorf("restored content = %q", content)
+	}
+}
+
+func TestRemoveStaleCAs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"nco-server.crt", "nco-mirror-0.crt", "nco-mirror-1.crt", "ca.crt"} {
+		if err := os.WriteFile(dir+"/"+name, []byte("cert"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeStaleCAs(dir, []string{dir + "/nco-server.crt", "", dir + "/nco-mirror-0.crt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"nco-server.crt":   true,
+		"nco-mirror-0.crt": true,
+		"nco-mirror-1.crt": false,
+		"ca.crt":           true,
+	} {
+		exists, err := checkFileExists(dir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 )
@@ -28,6 +32,7 @@ func (c Crontabs) IsPresent() bool {
 	return false
 }
 
+// +kubebuilder:object:generate=true
 // Crontab defines an individual crontab entry.
 type Crontab struct {
 	// Unique identifier for the cron job
@@ -59,11 +64,25 @@ type Crontab struct {
 	Job string `json:"job"`
 	// User under which the task will run
 	User string `json:"user"`
+	// Environment variables of the cron file, like MAILTO, PATH or SHELL
+	// +optional
+	Environment map[string]string `json:"environment,omitempty"`
 }
 
 type CrontabsConfig struct {
 	Crontabs
-	Log logr.Logger
+	Log          logr.Logger
+	resourceName string
+	ownerMarker  string
+}
+
+func NewCrontabsConfig(crontabs Crontabs, logger logr.Logger, name string) CrontabsConfig {
+	return CrontabsConfig{
+		Crontabs:     crontabs,
+		Log:          logger,
+		resourceName: name,
+		ownerMarker:  fmt.Sprintf("# NCO OWNER %s", name),
+	}
 }
 
 func (c CrontabsConfig) Reconcile() error {
@@ -95,58 +114,82 @@ func (c CrontabsConfig) Reconcile() error {
 
 func (c CrontabsConfig) applyModule() error {
 	// Ensure the cron service is active
-	active, err := checkIfServiceIsActive("cron")
-	if err != nil {
-		return fmt.Errorf("failed to check cron service status: %w", err)
-	}
-	if !active {
-		if err := startCronService(); err != nil {
-			return fmt.Errorf("failed to start cron service: %w", err)
-		}
+	if err := startCronService(); err != nil {
+		return err
 	}
 
 	// Apply the cron entries
+	if err := c.checkFileNames(); err != nil {
+		return err
+	}
+
+	desired := map[string]bool{}
 	for _, entry := range c.Entries {
 		c.Log.V(1).Info("Applying crontab entry", "name", entry.Name)
-		if err := entry.createCronFile(); err != nil {
+		fileName := c.cronFilePath(entry)
+		if err := c.createCronFile(entry, fileName); err != nil {
 			return fmt.Errorf("failed to apply crontab entry '%s': %w", entry.Name, err)
 		}
+		if err := entry.removeLegacyCronFile(); err != nil {
+			return err
+		}
+		desired[fileName] = true
 		c.Log.V(1).Info("Crontab applied", "name", entry.Name)
 	}
-	return nil
+
+	// Remove the entries deleted from the NodeConfig
+	return c.removeOwnedFiles(desired)
 }
 
 func (c CrontabsConfig) removeModule() error {
-	// Remove the cron entries
 	for _, entry := range c.Entries {
-		c.Log.V(1).Info("Removing crontab entry", "name", entry.Name)
-		if err := entry.removeCronFile(); err != nil {
-			return fmt.Errorf("failed to remove crontab entry '%s': %w", entry.Name, err)
+		if err := entry.removeLegacyCronFile(); err != nil {
+			return err
 		}
-		c.Log.V(1).Info("crontab removed", "name", entry.Name)
 	}
-	return nil
+
+	return c.removeOwnedFiles(map[string]bool{})
 }
 
-func (entry Crontab) createCronFile() error {
-	// Sanitize the name to ensure it's a valid filename
-	sanitizedName := sanitizeFileName(entry.Name)
+// cronFilePath returns the path of the cron file of the entry. cron ignores
+// files with characters other than letters, digits, underscores and hyphens
+// in their names
+func (c CrontabsConfig) cronFilePath(entry Crontab) string {
+	name := fmt.Sprintf("nco-%s-%s", c.resourceName, entry.Name)
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
 
-	// Build the filename
-	fileName := fmt.Sprintf("%s/%s", crontabsPath, sanitizedName)
+	return fmt.Sprintf("%s/%s", crontabsPath, name)
+}
 
-	// Build the cron line
-	var cronLine string
-	if entry.SpecialTime != "" {
-		cronLine = fmt.Sprintf("@%s %s %s # %s", entry.SpecialTime, entry.User, entry.Job, entry.Name)
-	} else {
-		cronLine = fmt.Sprintf("%s %s %s %s %s %s %s # %s",
-			entry.Minute, entry.Hour, entry.DayOfMonth,
-			entry.Month, entry.DayOfWeek, entry.User, entry.Job, entry.Name)
+// checkFileNames rejects entries whose names are replaced by the same file
+// name, like "a b" and "a_b"
+func (c CrontabsConfig) checkFileNames() error {
+	entries := map[string]string{}
+	for _, entry := range c.Entries {
+		fileName := c.cronFilePath(entry)
+		if other, ok := entries[fileName]; ok {
+			return fmt.Errorf("crontab entries '%s' and '%s' are written to the same file %s", other, entry.Name, fileName)
+		}
+		entries[fileName] = entry.Name
 	}
 
+	return nil
+}
+
+func (c CrontabsConfig) createCronFile(entry Crontab, fileName string) error {
+	if err := validateCrontab(entry); err != nil {
+		return err
+	}
+
+	content := cronFileContent(c.ownerMarker, entry)
+
 	// Check if the file already exists and has the same content
-	contentMatch, err := checkFileContents(fileName, cronLine)
+	contentMatch, err := checkFileContents(fileName, content)
 	if err != nil {
 		return fmt.Errorf("failed to check file contents for %s: %w", fileName, err)
 	}
@@ -154,38 +197,211 @@ func (entry Crontab) createCronFile() error {
 		return nil // No changes needed
 	}
 
-	// Write the file atomically using utils.writeFile
-	if err := writeFile(fileName, cronLine); err != nil {
+	// cron ignores files that are writable by the group or other users
+	if err := writeFileAtomic(fileName, content, 0644); err != nil {
 		return fmt.Errorf("failed to write cron file '%s': %w", fileName, err)
 	}
 
 	return nil
 }
 
-func (entry Crontab) removeCronFile() error {
-	// Sanitize the name to ensure it matches the filename
-	sanitizedName := sanitizeFileName(entry.Name)
-	fileName := fmt.Sprintf("%s/%s", crontabsPath, sanitizedName)
+// removeOwnedFiles deletes the cron files of this NodeConfig that are not in
+// the desired set. The files are identified by the owner marker in their
+// first lines, as names can collide across NodeConfigs
+func (c CrontabsConfig) removeOwnedFiles(desired map[string]bool) error {
+	files, err := ownedFiles(crontabsPath+"/nco-*", c.ownerMarker)
+	if err != nil {
+		return fmt.Errorf("failed to list cron files: %w", err)
+	}
 
-	// Check if the file exists
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		return nil
+	for _, fileName := range files {
+		if desired[fileName] {
+			continue
+		}
+
+		c.Log.Info("removing crontab", "path", fileName)
+		if err := deleteFileIfExists(fileName); err != nil {
+			return fmt.Errorf("failed to remove cron file '%s': %w", fileName, err)
+		}
 	}
 
-	// Remove the file
-	err := os.Remove(fileName)
+	return nil
+}
+
+// removeLegacyCronFile deletes the file written by previous versions, named
+// after the entry, if it still has the line of this entry
+func (entry Crontab) removeLegacyCronFile() error {
+	fileName := fmt.Sprintf("%s/%s", crontabsPath, sanitizeFileName(entry.Name))
+
+	content, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
+		return fmt.Errorf("failed to read cron file '%s': %w", fileName, err)
+	}
+
+	if !strings.HasSuffix(strings.TrimSpace(string(content)), "# "+entry.Name) {
+		return nil
+	}
+
+	if err := os.Remove(fileName); err != nil {
 		return fmt.Errorf("failed to remove cron file '%s': %w", fileName, err)
 	}
 	return nil
 }
 
+// validateCrontab checks the entry before writing it, as cron skips the
+// whole file if any line can't be parsed. The check is best-effort, the
+// schedule is validated with the syntax of crontab(5) but not with the
+// extensions of each cron implementation
+func validateCrontab(entry Crontab) error {
+	if entry.SpecialTime == "" {
+		schedule := []string{entry.Minute, entry.Hour, entry.DayOfMonth, entry.Month, entry.DayOfWeek}
+		for i, field := range cronScheduleFields {
+			if err := field.validate(schedule[i]); err != nil {
+				return fmt.Errorf("invalid schedule %q: %w", strings.Join(schedule, " "), err)
+			}
+		}
+	}
+
+	if strings.TrimSpace(entry.Job) == "" || strings.Contains(entry.Job, "\n") {
+		return errors.New("job must be a single line command")
+	}
+
+	if _, err := lookupHostUser(entry.User); err != nil {
+		return fmt.Errorf("invalid user %q: %w", entry.User, err)
+	}
+
+	for _, key := range sortedKeys(entry.Environment) {
+		if !cronEnvNameRegex.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if strings.Contains(entry.Environment[key], "\n") {
+			return fmt.Errorf("environment variable %s must be a single line", key)
+		}
+	}
+
+	return nil
+}
+
+var cronEnvNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// cronScheduleField is a field of the schedule of a cron line, with the
+// range of its values and the names accepted for them
+type cronScheduleField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+// Fields of the schedule in crontab(5). Day of week accepts 0-7, both 0 and 7
+// are Sunday
+var cronScheduleFields = []cronScheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// validate checks a list of values, ranges and steps (e.g. "1,5-10,*/15")
+func (f cronScheduleField) validate(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		rangeValue, step, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q in %s", step, f.name)
+			}
+		}
+
+		if rangeValue == "*" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(rangeValue, "-")
+		if hasStep && !isRange {
+			return fmt.Errorf("step without a range in %s: %q", f.name, item)
+		}
+		start, err := f.parseValue(first)
+		if err != nil {
+			return err
+		}
+		if isRange {
+			end, err := f.parseValue(last)
+			if err != nil {
+				return err
+			}
+			if end < start {
+				return fmt.Errorf("reversed range in %s: %q", f.name, rangeValue)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f cronScheduleField) parseValue(value string) (int, error) {
+	if index := slices.Index(f.names, strings.ToLower(value)); index != -1 {
+		return index + f.min, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, value, f.min, f.max)
+	}
+	return n, nil
+}
+
+// cronFileContent returns the cron file of the entry. The file must end with
+// a newline, cron ignores the last line otherwise
+func cronFileContent(ownerMarker string, entry Crontab) string {
+	lines := []string{overrideHeader, ownerMarker}
+	for _, key := range sortedKeys(entry.Environment) {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, entry.Environment[key]))
+	}
+
+	// Build the cron line
+	if entry.SpecialTime != "" {
+		lines = append(lines, fmt.Sprintf("@%s %s %s # %s", entry.SpecialTime, entry.User, entry.Job, entry.Name))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s %s %s %s %s %s %s # %s",
+			entry.Minute, entry.Hour, entry.DayOfMonth,
+			entry.Month, entry.DayOfWeek, entry.User, entry.Job, entry.Name))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// cronServiceName returns the name of the cron service, which is crond on RHEL
+// based hosts and cron on Debian based hosts
+func cronServiceName() (string, error) {
+	isCrond, err := checkFileExists("/host/usr/sbin/crond")
+	if err != nil {
+		return "", fmt.Errorf("failed to detect cron service: %w", err)
+	}
+	if isCrond {
+		return "crond", nil
+	}
+	return "cron", nil
+}
+
 func startCronService() error {
-	_, err := execChroot("systemctl", "start", "cron")
+	serviceName, err := cronServiceName()
+	if err != nil {
+		return err
+	}
+
+	if _, err := execChroot("systemctl", "is-active", "--quiet", serviceName); err == nil {
+		return nil
+	}
+
+	_, err = execChroot("systemctl", "start", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to start cron service: %w", err)
 	}
-	isActive, err := checkIfServiceIsActive("cron")
+	isActive, err := checkIfServiceIsActive(serviceName)
 	if err != nil {
 		return err
 	}
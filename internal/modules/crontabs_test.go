@@ -0,0 +1,96 @@
+package modules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestCronFileContent(t *testing.T) {
+	content := cronFileContent("# NCO OWNER default-sample", Crontab{
+		Name:        "cleanup",
+		Minute:      "0",
+		Hour:        "*/2",
+		DayOfMonth:  "*",
+		Month:       "*",
+		DayOfWeek:   "*",
+		Job:         "/usr/bin/cleanup.sh",
+		User:        "root",
+		Environment: map[string]string{"PATH": "/usr/bin:/bin", "MAILTO": ""},
+	})
+
+	expected := overrideHeader + `
+# NCO OWNER default-sample
+MAILTO=
+PATH=/usr/bin:/bin
+0 */2 * * * root /usr/bin/cleanup.sh # cleanup
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestCronFilePath(t *testing.T) {
+	config := NewCrontabsConfig(Crontabs{}, logr.Discard(), "default-node.config")
+	path := config.cronFilePath(Crontab{Name: "daily backup"})
+	if path != crontabsPath+"/nco-default-node_config-daily_backup" {
+		t.Errorf("unexpected path %s", path)
+	}
+}
+
+func TestCronCheckFileNames(t *testing.T) {
+	config := NewCrontabsConfig(Crontabs{Entries: []Crontab{{Name: "a b"}, {Name: "a-b"}}}, logr.Discard(), "default")
+	if err := config.checkFileNames(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config.Entries = append(config.Entries, Crontab{Name: "a_b"})
+	if err := config.checkFileNames(); err == nil {
+		t.Error("expected error for entries written to the same file")
+	}
+}
+
+func TestValidateCrontabSchedule(t *testing.T) {
+	err := validateCrontab(Crontab{Minute: "61", Hour: "*", DayOfMonth: "*", Month: "*", DayOfWeek: "*", Job: "true"})
+	if err == nil || !strings.Contains(err.Error(), "invalid schedule") {
+		t.Errorf("expected schedule error, got %v", err)
+	}
+
+	err = validateCrontab(Crontab{SpecialTime: "daily", Job: "true\nrm -rf /"})
+	if err == nil {
+		t.Error("expected error for a multiline job")
+	}
+}
+
+func TestCronScheduleFields(t *testing.T) {
+	valid := [][]string{
+		{"*", "*", "*", "*", "*"},
+		{"*/15", "0-23/2", "1,15,31", "jan", "7"},
+		{"0", "8-17", "*", "Jun-Aug", "mon-fri"},
+		{"30", "2", "1-7", "*", "0,7"},
+		{"0", "0", "*", "12", "5-7"},
+	}
+	for _, schedule := range valid {
+		for i, field := range cronScheduleFields {
+			if err := field.validate(schedule[i]); err != nil {
+				t.Errorf("unexpected error for %v: %v", schedule, err)
+			}
+		}
+	}
+
+	invalid := map[int][]string{
+		0: {"60", "-1", "*/0", "5/10", "", "1,,2", "a"},
+		1: {"24", "10-2"},
+		2: {"0", "32"},
+		3: {"13", "foo"},
+		4: {"8", "sun-7-1", "monday"},
+	}
+	for i, values := range invalid {
+		for _, value := range values {
+			if err := cronScheduleFields[i].validate(value); err == nil {
+				t.Errorf("expected error for %s %q", cronScheduleFields[i].name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	FILE_TYPE      = "file"
+	DIRECTORY_TYPE = "directory"
+	SYMLINK_TYPE   = "symlink"
+	ABSENT_TYPE    = "absent"
+)
+
+// +kubebuilder:object:generate=true
+// Files defines the files, directories and symlinks owned by the operator
+type Files struct {
+	Files []File `json:"files,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (f Files) IsPresent() bool {
+	if len(f.Files) != 0 && f.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type File struct {
+	// Absolute path of the file in the host
+	Path string `json:"path"`
+	// Type of the path. "absent" ensures the path doesn't exist
+	// +kubebuilder:validation:Enum=file;directory;symlink;absent
+	// +kubebuilder:default:=file
+	Type string `json:"type,omitempty"`
+	// Contents of the file
+	Content string `json:"content,omitempty"`
+	// Secret key with the contents of the file, takes precedence over content
+	// +optional
+	ContentFrom *SecretKeyRef `json:"contentFrom,omitempty"`
+	// Path the symlink points to, only used by symlinks
+	Target string `json:"target,omitempty"`
+	// Permissions in octal notation (default: "0644" for files, "0755" for directories)
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3,4}$`
+	Mode string `json:"mode,omitempty"`
+	// Owner of the path (default: root)
+	Owner string `json:"owner,omitempty"`
+	// Group of the path (default: the owner's primary group)
+	Group string `json:"group,omitempty"`
+	// Action to run after the path changes
+	// +optional
+	OnChange *FileOnChange `json:"onChange,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type FileOnChange struct {
+	// Systemd unit to restart
+	RestartUnit string `json:"restartUnit,omitempty"`
+	// Command to run in the host
+	Command []string `json:"command,omitempty"`
+}
+
+type FilesConfig struct {
+	Files
+	logger     logr.Logger
+	readSecret SecretReader
+}
+
+func NewFilesConfig(files Files, logger logr.Logger, readSecret SecretReader) FilesConfig {
+	return FilesConfig{
+		Files:      files,
+		logger:     logger,
+		readSecret: readSecret,
+	}
+}
+
+func (f FilesConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		f.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"files", nil}
+	if f.State == "present" {
+		f.logger.V(1).Info("applying module")
+		if err := f.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		f.logger.V(1).Info("module applied")
+	} else if f.State == "absent" {
+		f.logger.V(1).Info("removing module")
+		if err := f.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		f.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (f FilesConfig) applyModule() error {
+	for _, file := range f.Files.Files {
+		if err := validateFilePath(file.Path); err != nil {
+			return err
+		}
+
+		var isChanged bool
+		var err error
+		switch file.Type {
+		case DIRECTORY_TYPE:
+			isChanged, err = f.applyDirectory(file)
+		case SYMLINK_TYPE:
+			isChanged, err = f.applySymlink(file)
+		case ABSENT_TYPE:
+			isChanged, err = removePath("/host"+file.Path, f.logger)
+		default:
+			isChanged, err = f.applyFile(file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", file.Path, err)
+		}
+
+		if isChanged {
+			f.logger.V(1).Info("path changed", "path", file.Path, "type", file.Type)
+			if file.OnChange != nil {
+				if err := newPendingAction("files", file.Path).mark(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return f.runOnChange()
+}
+
+func (f FilesConfig) removeModule() error {
+	for _, file := range f.Files.Files {
+		if err := validateFilePath(file.Path); err != nil {
+			return err
+		}
+
+		if _, err := removePath("/host"+file.Path, f.logger); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// applyFile writes the file if the hash of its contents differs from the
+// desired contents and sets its mode and owner
+func (f FilesConfig) applyFile(file File) (bool, error) {
+	content := file.Content
+	if file.ContentFrom != nil {
+		value, err := f.readSecret(*file.ContentFrom)
+		if err != nil {
+			return false, err
+		}
+		content = value
+	}
+
+	mode, err := parseFileMode(file.Mode, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	path := "/host" + file.Path
+	if info, err := os.Lstat(path); err == nil && !info.Mode().IsRegular() {
+		return false, fmt.Errorf("path exists and is not a regular file")
+	}
+
+	currentHash, err := fileSHA256(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	changed := false
+	if currentHash != contentSHA256(content) {
+		if err := writeFileAtomic(path, content, mode); err != nil {
+			return false, fmt.Errorf("failed to write file: %w", err)
+		}
+		changed = true
+	}
+
+	attrsChanged, err := setFileAttributes(path, mode, file.Owner, file.Group)
+	if err != nil {
+		return false, err
+	}
+
+	return changed || attrsChanged, nil
+}
+
+func (f FilesConfig) applyDirectory(file File) (bool, error) {
+	mode, err := parseFileMode(file.Mode, 0755)
+	if err != nil {
+		return false, err
+	}
+
+	path := "/host" + file.Path
+	changed := false
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(path, mode); err != nil {
+			return false, fmt.Errorf("failed to create directory: %w", err)
+		}
+		changed = true
+	} else if err != nil {
+		return false, err
+	} else if !info.IsDir() {
+		return false, fmt.Errorf("path exists and is not a directory")
+	}
+
+	attrsChanged, err := setFileAttributes(path, mode, file.Owner, file.Group)
+	if err != nil {
+		return false, err
+	}
+
+	return changed || attrsChanged, nil
+}
+
+func (f FilesConfig) applySymlink(file File) (bool, error) {
+	if file.Target == "" {
+		return false, errors.New("symlink target is empty")
+	}
+
+	path := "/host" + file.Path
+	currentTarget, err := os.Readlink(path)
+	if err == nil && currentTarget == file.Target {
+		return false, nil
+	}
+
+	if err == nil {
+		// The symlink points to another target
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("failed to remove previous symlink: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("path exists and is not a symlink")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Symlink(file.Target, path); err != nil {
+		return false, fmt.Errorf("failed to create symlink: %w", err)
+	}
+
+	uid, gid, err := resolveOwner(file.Owner, file.Group)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		return false, fmt.Errorf("failed to set symlink owner: %w", err)
+	}
+
+	return true, nil
+}
+
+// runOnChange restarts the units and runs the commands of the files with a
+// pending action, which are the files that changed in this or a previous
+// reconciliation where the action failed. Each unit is restarted only once
+// even if multiple files changed
+func (f FilesConfig) runOnChange() error {
+	restartedUnits := []string{}
+	for _, file := range f.Files.Files {
+		if file.OnChange == nil {
+			continue
+		}
+
+		action := newPendingAction("files", file.Path)
+		pending, err := action.isPending()
+		if err != nil {
+			return err
+		}
+		if !pending {
+			continue
+		}
+
+		unit := file.OnChange.RestartUnit
+		if unit != "" && !slices.Contains(restartedUnits, unit) {
+			f.logger.Info("restarting unit", "unit", unit, "path", file.Path)
+			if output, err := execChroot("systemctl", "restart", unit); err != nil {
+				return fmt.Errorf("failed to restart unit %s: %s", unit, strings.TrimSpace(string(output)))
+			}
+			restartedUnits = append(restartedUnits, unit)
+		}
+
+		if len(file.OnChange.Command) != 0 {
+			f.logger.Info("running command", "command", file.OnChange.Command, "path", file.Path)
+			if output, err := execChroot(file.OnChange.Command...); err != nil {
+				return fmt.Errorf("failed to run command for %s: %s", file.Path, strings.TrimSpace(string(output)))
+			}
+		}
+
+		if err := action.done(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removePath deletes a file, symlink or empty directory. Directories that
+// aren't empty are kept so files not managed by the operator aren't lost
+func removePath(path string, logger logr.Logger) (bool, error) {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return false, err
+		}
+		if len(entries) != 0 {
+			logger.Info("directory is not empty, skipping removal", "path", path)
+			return false, nil
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// setFileAttributes sets the mode and owner of path, returning true if any
+// of them changed
+func setFileAttributes(path string, mode os.FileMode, owner, group string) (bool, error) {
+	uid, gid, err := resolveOwner(owner, group)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	specialBits := os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if info.Mode()&(os.ModePerm|specialBits) != mode {
+		if err := os.Chmod(path, mode); err != nil {
+			return false, fmt.Errorf("failed to set mode: %w", err)
+		}
+		changed = true
+	}
+
+	currentUID, currentGID := fileOwner(info)
+	if currentUID != uid || currentGID != gid {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return false, fmt.Errorf("failed to set owner: %w", err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// resolveOwner returns the uid and gid of the owner and group in the host.
+// The group defaults to the owner's primary group and the owner to root
+func resolveOwner(owner, group string) (int, int, error) {
+	uid, gid := 0, 0
+	if owner != "" {
+		u, err := lookupHostUser(owner)
+		if err != nil {
+			return 0, 0, err
+		}
+		uid, gid = u.uid, u.gid
+	}
+
+	if group != "" {
+		g, err := lookupHostGroup(group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid = g
+	}
+
+	return uid, gid, nil
+}
+
+func parseFileMode(mode string, defaultMode os.FileMode) (os.FileMode, error) {
+	if mode == "" {
+		return defaultMode, nil
+	}
+
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %s: %w", mode, err)
+	}
+
+	// Go uses its own bits for setuid, setgid and sticky
+	fileMode := os.FileMode(value).Perm()
+	if value&04000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if value&02000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if value&01000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+
+	return fileMode, nil
+}
+
+func fileOwner(info os.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
+
+// validateFilePath checks that the path is absolute and doesn't escape the
+// host's filesystem
+func validateFilePath(path string) error {
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path || path == "/" {
+		return fmt.Errorf("path %s must be absolute and clean", path)
+	}
+	return nil
+}
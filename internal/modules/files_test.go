@@ -0,0 +1,51 @@
+package modules
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected os.FileMode
+	}{
+		{"", 0644},
+		{"0600", 0600},
+		{"755", 0755},
+		{"4755", 0755 | os.ModeSetuid},
+		{"1777", 0777 | os.ModeSticky},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := parseFileMode(tt.mode, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, mode)
+			}
+		})
+	}
+
+	if _, err := parseFileMode("0999", 0644); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestValidateFilePath(t *testing.T) {
+	valid := []string{"/etc/test.conf", "/opt/app/config"}
+	invalid := []string{"", "/", "etc/test.conf", "/etc/../root/.bashrc", "/etc//test"}
+
+	for _, path := range valid {
+		if err := validateFilePath(path); err != nil {
+			t.Errorf("expected %q to be valid: %s", path, err)
+		}
+	}
+	for _, path := range invalid {
+		if err := validateFilePath(path); err == nil {
+			t.Errorf("expected %q to be invalid", path)
+		}
+	}
+}
@@ -6,15 +6,30 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/go-logr/logr"
 )
 
 const (
-	grubCfgPath           = "/boot/grub/grub.cfg"
 	grubKernelBeginMarker = "# BEGIN MARKER NCO GRUB CONFIG"
 	grubKernelEndMarker   = "# END MARKER NCO GRUB CONFIG"
+	grubbyStatePath       = "/host/etc/nco"
+	procOSReleasePath     = "/proc/sys/kernel/osrelease"
+)
+
+// Paths of grub.cfg on Debian and RHEL based hosts
+var grubCfgPaths = []string{"/boot/grub/grub.cfg", "/boot/grub2/grub.cfg"}
+
+// Kernel arguments are written to shell scripts and passed to grubby, so
+// quotes and other shell characters are rejected
+var kernelArgRegex = regexp.MustCompile(`^[A-Za-z0-9_.,:/=+@%~-]+$`)
+
+// Title and ID of the submenu and menuentry lines of grub.cfg
+var (
+	grubMenuTitleRegex = regexp.MustCompile(`^(submenu|menuentry) '([^']*)'`)
+	grubMenuIDRegex    = regexp.MustCompile(`\$menuentry_id_option '([^']*)'`)
 )
 
 // +kubebuilder:object:generate=true
@@ -24,6 +39,13 @@ type GrubKernel struct {
 	KernelVersion string `json:"kernelVersion,omitempty"`
 	// CmdlineArgs stores kernel boot parameters to be added to GRUB_CMDLINE_LINUX
 	CmdlineArgs []string `json:"args,omitempty"`
+	// AddArgs are appended to the existing kernel command line
+	// +optional
+	AddArgs []string `json:"addArgs,omitempty"`
+	// RemoveArgs are removed from the existing kernel command line. An
+	// argument without a value (e.g. "console") removes it with any value
+	// +optional
+	RemoveArgs []string `json:"removeArgs,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 	// Priority for grub config (default: 50)
@@ -36,17 +58,19 @@ type GrubKernel struct {
 
 // IsPresent method checks if the module is present
 func (g GrubKernel) IsPresent() bool {
-	if g.KernelVersion != "" && len(g.CmdlineArgs) != 0 && g.State == "present" {
-		return true
+	if g.State != "present" {
+		return false
 	}
-	return false
+	return len(g.CmdlineArgs) != 0 || len(g.AddArgs) != 0 || len(g.RemoveArgs) != 0 || g.KernelVersion != ""
 }
 
 type GrubKernelConfig struct {
 	GrubKernel
+	*statusRecorder
 	Log          logr.Logger
 	fileName     string
 	prevFileName string
+	stateFile    string
 }
 
 func NewGrubKernelConfig(grubKernel GrubKernel, logger logr.Logger, name string) GrubKernelConfig {
@@ -56,10 +80,12 @@ func NewGrubKernelConfig(grubKernel GrubKernel, logger logr.Logger, name string)
 	prevFileName := fmt.Sprintf("%s/99-nco.cfg", folder)
 
 	return GrubKernelConfig{
-		GrubKernel:   grubKernel,
-		Log:          logger,
-		fileName:     fileName,
-		prevFileName: prevFileName,
+		GrubKernel:     grubKernel,
+		statusRecorder: newStatusRecorder("grubKernelConfig"),
+		Log:            logger,
+		fileName:       fileName,
+		prevFileName:   prevFileName,
+		stateFile:      fmt.Sprintf("%s/grub-%s.state", grubbyStatePath, name),
 	}
 }
 
@@ -72,15 +98,30 @@ func (gkc GrubKernelConfig) Reconcile() error {
 		return nil
 	}
 
+	useGrubby, err := usesGrubby()
+	if err != nil {
+		return fmt.Errorf("failed to detect boot loader: %w", err)
+	}
+
 	if gkc.State == "present" {
 		gkc.Log.V(1).Info("applying module")
-		if err := gkc.applyModule(); err != nil {
+		if useGrubby {
+			err = gkc.applyGrubby()
+		} else {
+			err = gkc.applyModule()
+		}
+		if err != nil {
 			return fmt.Errorf("failed to apply module: %w", err)
 		}
 		gkc.Log.V(1).Info("module applied")
 	} else if gkc.State == "absent" {
 		gkc.Log.V(1).Info("removing module")
-		if err := gkc.removeModule(); err != nil {
+		if useGrubby {
+			err = gkc.removeGrubby()
+		} else {
+			err = gkc.removeModule()
+		}
+		if err != nil {
 			return fmt.Errorf("failed to remove module: %w", err)
 		}
 		gkc.Log.V(1).Info("module removed")
@@ -88,6 +129,17 @@ func (gkc GrubKernelConfig) Reconcile() error {
 	return nil
 }
 
+// usesGrubby checks if the host boots from Boot Loader Specification entries
+// managed by grubby, like RHEL and Fedora. Kernel arguments in
+// /etc/default/grub.d aren't used by these entries
+func usesGrubby() (bool, error) {
+	hasGrubby, err := checkFileExists("/host/usr/sbin/grubby")
+	if err != nil || !hasGrubby {
+		return false, err
+	}
+	return checkFileExists("/host/boot/loader/entries")
+}
+
 // applyModule applies the GRUB configuration changes.
 func (gkc GrubKernelConfig) applyModule() error {
 	// remove previous grub config as it's not needed anymore
@@ -95,55 +147,69 @@ func (gkc GrubKernelConfig) applyModule() error {
 		return fmt.Errorf("failed to delete prevFileName: %w", err)
 	}
 
-	// Build the desired content for the file
-	var blockLines []string
-	if len(gkc.CmdlineArgs) > 0 {
-		cmdlineArgs := strings.Join(gkc.CmdlineArgs, " ")
-		blockLines = append(blockLines, fmt.Sprintf("GRUB_CMDLINE_LINUX=\"%s\"", cmdlineArgs))
+	if err := gkc.validateArgs(); err != nil {
+		return err
+	}
+
+	grubCfg, err := readGrubCfg()
+	if err != nil {
+		return err
 	}
+	entries := parseGrubMenuEntries(grubCfg)
+
+	var menuEntry string
 	if gkc.KernelVersion != "" {
-		kernelEntry, err := gkc.findKernelEntry()
+		entry, err := findKernelEntry(entries, gkc.KernelVersion)
 		if err != nil {
 			return fmt.Errorf("kernel entry not found: %w", err)
 		}
-		blockLines = append(blockLines, fmt.Sprintf("GRUB_DEFAULT=\"%s\"", kernelEntry))
-	}
-	desiredBlock := strings.Join(blockLines, "\n")
-	if desiredBlock != "" {
-		desiredBlock = fmt.Sprintf("%s\n%s\n%s\n", grubKernelBeginMarker, desiredBlock, grubKernelEndMarker)
+		menuEntry = entry.defaultValue()
 	}
 
 	// Check if the file already has the desired content
-	if desiredBlock != "" {
-		matches, err := checkFileContents(gkc.fileName, desiredBlock)
-		if err != nil {
-			return fmt.Errorf("error checking file contents: %w", err)
-		}
-		if matches {
-			gkc.Log.V(1).Info("GRUB configuration is already in the desired state, no changes needed")
-			return nil
-		}
+	desiredBlock := grubDefaultsContent(gkc.GrubKernel, menuEntry)
+	matches, err := checkFileContents(gkc.fileName, desiredBlock)
+	if err != nil {
+		return fmt.Errorf("error checking file contents: %w", err)
 	}
 
-	// Verify that the kernel is installed if specified
-	if gkc.KernelVersion != "" {
-		if err := gkc.ensureKernelInstalled(); err != nil {
-			return fmt.Errorf("kernel installation verification failed: %w", err)
+	if !matches {
+		// Verify that the kernel is installed if specified
+		if gkc.KernelVersion != "" {
+			if err := gkc.ensureKernelInstalled(); err != nil {
+				return fmt.Errorf("kernel installation verification failed: %w", err)
+			}
 		}
-	}
 
-	// Write the configuration to the file
-	if desiredBlock != "" {
 		if err := writeFile(gkc.fileName, desiredBlock); err != nil {
 			return fmt.Errorf("error writing GRUB configuration: %w", err)
 		}
 		gkc.Log.V(1).Info("GRUB configuration updated")
+
+		if err := gkc.runUpdateGrub(); err != nil {
+			return fmt.Errorf("error running update-grub: %w", err)
+		}
+
+		// grub.cfg was generated again
+		if grubCfg, err = readGrubCfg(); err != nil {
+			return err
+		}
+		entries = parseGrubMenuEntries(grubCfg)
+	} else {
+		gkc.Log.V(1).Info("GRUB configuration is already in the desired state, no changes needed")
 	}
 
-	if err := gkc.runUpdateGrub(); err != nil {
-		return fmt.Errorf("error running update-grub: %w", err)
+	// The first entry is booted unless a kernel version is set
+	var pending []string
+	if gkc.KernelVersion != "" {
+		if entry, err := findKernelEntry(entries, gkc.KernelVersion); err == nil {
+			pending = entry.args
+		}
+	} else if len(entries) != 0 {
+		pending = entries[0].args
 	}
-	return nil
+
+	return gkc.recordBootStatus(pending)
 }
 
 // removeModule reverts the GRUB configuration changes.
@@ -164,6 +230,7 @@ func (gkc GrubKernelConfig) removeModule() error {
 			return fmt.Errorf("error running update-grub: %w", err)
 		}
 		gkc.Log.V(1).Info("Configuration file deleted and GRUB updated")
+		gkc.recordRebootRequired("cmdline", "GRUB configuration removed")
 	} else if errors.Is(err, os.ErrNotExist) {
 		// The file doesn't exist, no action needed
 		gkc.Log.V(1).Info("The file does not exist, no action required")
@@ -174,6 +241,194 @@ func (gkc GrubKernelConfig) removeModule() error {
 	return nil
 }
 
+// applyGrubby updates the arguments of all the boot entries with grubby. The
+// arguments added and removed are kept in a state file, so they can be
+// reverted when they're no longer in the NodeConfig.
+func (gkc GrubKernelConfig) applyGrubby() error {
+	if len(gkc.CmdlineArgs) != 0 {
+		return errors.New("args replaces GRUB_CMDLINE_LINUX and is not supported with grubby, use addArgs and removeArgs")
+	}
+	if err := gkc.validateArgs(); err != nil {
+		return err
+	}
+
+	state, err := readGrubbyState(gkc.stateFile)
+	if err != nil {
+		return err
+	}
+	entries, err := grubbyEntries("ALL")
+	if err != nil {
+		return err
+	}
+
+	// Arguments added by a previous version of the NodeConfig are removed, and
+	// the ones it removed are restored in the entries that had them
+	toAdd, staleArgs, added := grubbyArgsDiff(entries, state.added, gkc.AddArgs)
+	toRemove, toRestore, removed := grubbyRemoveDiff(entries, state, gkc.RemoveArgs)
+	for _, arg := range staleArgs {
+		if !slices.Contains(toRemove, arg) {
+			toRemove = append(toRemove, arg)
+		}
+	}
+
+	// The stale and restored arguments are kept in the state until grubby
+	// succeeds, so they're retried if it fails midway
+	state.added = append(slices.Clone(added), staleArgs...)
+	state.removed = append(slices.Clone(removed), toRestore...)
+	if err := writeGrubbyState(gkc.stateFile, state); err != nil {
+		return err
+	}
+
+	if len(toRemove) != 0 {
+		if err := runGrubby("--update-kernel=ALL", "--remove-args="+strings.Join(toRemove, " ")); err != nil {
+			return err
+		}
+		gkc.Log.Info("kernel arguments removed", "args", toRemove)
+	}
+	if len(toAdd) != 0 {
+		if err := runGrubby("--update-kernel=ALL", "--args="+strings.Join(toAdd, " ")); err != nil {
+			return err
+		}
+		gkc.Log.Info("kernel arguments added", "args", toAdd)
+	}
+	if err := restoreGrubbyArgs(toRestore); err != nil {
+		return err
+	}
+
+	if gkc.KernelVersion != "" {
+		if err := gkc.ensureKernelInstalled(); err != nil {
+			return fmt.Errorf("kernel installation verification failed: %w", err)
+		}
+		kernel := "/boot/vmlinuz-" + gkc.KernelVersion
+		output, err := execChroot("grubby", "--default-kernel")
+		if err != nil {
+			return fmt.Errorf("failed to get default kernel: %s", strings.TrimSpace(string(output)))
+		}
+		if current := strings.TrimSpace(string(output)); current != kernel {
+			if state.defaultKernel == "" {
+				state.defaultKernel = current
+			}
+			if err := runGrubby("--set-default=" + kernel); err != nil {
+				return err
+			}
+			gkc.Log.Info("default kernel updated", "kernel", kernel)
+		}
+	}
+
+	state.added = added
+	state.removed = removed
+	if err := writeGrubbyState(gkc.stateFile, state); err != nil {
+		return err
+	}
+
+	var pending []string
+	if defaultEntries, err := grubbyEntries("DEFAULT"); err == nil && len(defaultEntries) != 0 {
+		pending = defaultEntries[0].args
+	}
+	return gkc.recordBootStatus(pending)
+}
+
+// removeGrubby reverts the changes listed in the state file.
+func (gkc GrubKernelConfig) removeGrubby() error {
+	exists, err := checkFileExists(gkc.stateFile)
+	if err != nil {
+		return fmt.Errorf("failed to check state file: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	state, err := readGrubbyState(gkc.stateFile)
+	if err != nil {
+		return err
+	}
+
+	if len(state.added) != 0 {
+		if err := runGrubby("--update-kernel=ALL", "--remove-args="+strings.Join(state.added, " ")); err != nil {
+			return err
+		}
+	}
+	entries, err := grubbyEntries("ALL")
+	if err != nil {
+		return err
+	}
+	_, toRestore, _ := grubbyRemoveDiff(entries, grubbyState{removed: state.removed}, nil)
+	if err := restoreGrubbyArgs(toRestore); err != nil {
+		return err
+	}
+	if state.defaultKernel != "" {
+		kernelExists, err := checkFileExists("/host" + state.defaultKernel)
+		if err != nil {
+			return fmt.Errorf("error checking kernel installation: %w", err)
+		}
+		if kernelExists {
+			if err := runGrubby("--set-default=" + state.defaultKernel); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := deleteFileIfExists(gkc.stateFile); err != nil {
+		return fmt.Errorf("failed to delete state file: %w", err)
+	}
+	gkc.recordRebootRequired("cmdline", "GRUB configuration removed")
+	return nil
+}
+
+// validateArgs checks the syntax of the arguments and that no argument is
+// both added and removed.
+func (gkc GrubKernelConfig) validateArgs() error {
+	args := slices.Concat(gkc.CmdlineArgs, gkc.AddArgs, gkc.RemoveArgs)
+	for _, arg := range args {
+		if !kernelArgRegex.MatchString(arg) {
+			return fmt.Errorf("invalid kernel argument %q", arg)
+		}
+	}
+	for _, arg := range slices.Concat(gkc.CmdlineArgs, gkc.AddArgs) {
+		if matchesAnyKernelArg(arg, gkc.RemoveArgs) {
+			return fmt.Errorf("kernel argument %s is both added and removed", arg)
+		}
+	}
+	return nil
+}
+
+// recordBootStatus reports the command line of the running kernel, and
+// whether a reboot is needed to apply the pending one. The arguments are
+// compared instead of the whole command lines, as the boot loader adds its
+// own arguments.
+func (gkc GrubKernelConfig) recordBootStatus(pending []string) error {
+	content, err := os.ReadFile(procCmdlinePath)
+	if err != nil {
+		return fmt.Errorf("failed to read kernel cmdline: %w", err)
+	}
+	running := strings.Fields(string(content))
+	desired := slices.Concat(gkc.CmdlineArgs, gkc.AddArgs)
+
+	if pending != nil {
+		if diff := kernelArgsDiff(pending, desired, gkc.RemoveArgs); len(diff) != 0 {
+			gkc.recordWarning("cmdline", fmt.Sprintf("boot configuration doesn't match: %s, another configuration may override it", strings.Join(diff, ", ")))
+			return nil
+		}
+	}
+
+	if diff := kernelArgsDiff(running, desired, gkc.RemoveArgs); len(diff) != 0 {
+		gkc.recordRebootRequired("cmdline", fmt.Sprintf("pending cmdline %q, running cmdline %q", strings.Join(pending, " "), strings.Join(running, " ")))
+	} else {
+		gkc.record("cmdline", strings.Join(running, " "))
+	}
+
+	if gkc.KernelVersion != "" {
+		release, err := os.ReadFile(procOSReleasePath)
+		if err != nil {
+			return fmt.Errorf("failed to read kernel release: %w", err)
+		}
+		if current := strings.TrimSpace(string(release)); current != gkc.KernelVersion {
+			gkc.recordRebootRequired("kernel", fmt.Sprintf("pending kernel %s, running kernel %s", gkc.KernelVersion, current))
+		}
+	}
+	return nil
+}
+
 // ensureKernelInstalled checks if the specified kernel is installed.
 func (gkc GrubKernelConfig) ensureKernelInstalled() error {
 	kernelPath := filepath.Join("/host/boot", "vmlinuz-"+gkc.KernelVersion)
@@ -197,32 +452,370 @@ func (gkc GrubKernelConfig) runUpdateGrub() error {
 	return nil
 }
 
-// findKernelEntry finds the descriptive name of the specified kernel in the GRUB menu.
-func (gkc GrubKernelConfig) findKernelEntry() (string, error) {
-	// Extract only lines containing the kernel version value
-	output, err := execChroot("grep", "menuentry .* "+gkc.KernelVersion, grubCfgPath)
+func runGrubby(args ...string) error {
+	output, err := execChroot(append([]string{"grubby"}, args...)...)
+	if err != nil {
+		return fmt.Errorf("grubby failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// grubbyState lists the changes done with grubby by a NodeConfig. Added
+// arguments are removed from all the entries, while removed ones are restored
+// only in the entries that had them
+type grubbyState struct {
+	added         []string
+	removed       []grubbyArg
+	defaultKernel string
+}
+
+// grubbyArg is an argument of the boot entry of a kernel
+type grubbyArg struct {
+	kernel string
+	arg    string
+}
+
+// grubbyRemoveDiff returns the arguments of the entries that match remove,
+// the ones removed before that must be restored, and the arguments removed by
+// the operator once they're applied. Entries that no longer exist are
+// dropped from the state
+func grubbyRemoveDiff(entries []grubbyEntry, state grubbyState, remove []string) ([]string, []grubbyArg, []grubbyArg) {
+	toRemove := []string{}
+	toRestore := []grubbyArg{}
+	removed := []grubbyArg{}
+	for _, entry := range entries {
+		for _, prev := range state.removed {
+			if prev.kernel != entry.kernel || slices.Contains(removed, prev) || slices.Contains(toRestore, prev) {
+				continue
+			}
+			if matchesAnyKernelArg(prev.arg, remove) {
+				removed = append(removed, prev)
+			} else if !slices.Contains(entry.args, prev.arg) {
+				toRestore = append(toRestore, prev)
+			}
+		}
+
+		for _, arg := range entry.args {
+			if !matchesAnyKernelArg(arg, remove) {
+				continue
+			}
+			if !slices.Contains(toRemove, arg) {
+				toRemove = append(toRemove, arg)
+			}
+			// Arguments added by the operator aren't restored
+			current := grubbyArg{kernel: entry.kernel, arg: arg}
+			if !slices.Contains(state.added, arg) && !slices.Contains(removed, current) {
+				removed = append(removed, current)
+			}
+		}
+	}
+	return toRemove, toRestore, removed
+}
+
+// restoreGrubbyArgs adds the arguments back to the entries they were removed
+// from
+func restoreGrubbyArgs(args []grubbyArg) error {
+	kernels := []string{}
+	byKernel := map[string][]string{}
+	for _, arg := range args {
+		if _, ok := byKernel[arg.kernel]; !ok {
+			kernels = append(kernels, arg.kernel)
+		}
+		byKernel[arg.kernel] = append(byKernel[arg.kernel], arg.arg)
+	}
+
+	for _, kernel := range kernels {
+		if err := runGrubby("--update-kernel="+kernel, "--args="+strings.Join(byKernel[kernel], " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readGrubbyState(path string) (grubbyState, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return grubbyState{}, nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to extract menuentry lines from GRUB config: %w", err)
+		return grubbyState{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+	return parseGrubbyState(string(content)), nil
+}
+
+func writeGrubbyState(path string, state grubbyState) error {
+	content := state.content()
+	isCurrent, err := checkFileContents(path, content)
+	if err != nil {
+		return fmt.Errorf("failed to check state file: %w", err)
+	}
+	if isCurrent {
+		return nil
+	}
+
+	if err := writeFile(path, content); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+func parseGrubbyState(content string) grubbyState {
+	state := grubbyState{}
+	for _, line := range strings.Split(content, "\n") {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "add":
+			state.added = append(state.added, value)
+		case "remove":
+			if kernel, arg, found := strings.Cut(value, " "); found {
+				state.removed = append(state.removed, grubbyArg{kernel: kernel, arg: arg})
+			}
+		case "default":
+			state.defaultKernel = value
+		}
+	}
+	return state
+}
+
+func (s grubbyState) content() string {
+	lines := []string{}
+	for _, arg := range s.added {
+		lines = append(lines, "add "+arg)
+	}
+	for _, arg := range s.removed {
+		lines = append(lines, "remove "+arg.kernel+" "+arg.arg)
+	}
+	if s.defaultKernel != "" {
+		lines = append(lines, "default "+s.defaultKernel)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// grubbyEntry is a boot entry as shown by grubby --info
+type grubbyEntry struct {
+	kernel string
+	args   []string
+}
+
+func grubbyEntries(kernel string) ([]grubbyEntry, error) {
+	output, err := execChroot("grubby", "--info="+kernel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get boot entries: %s", strings.TrimSpace(string(output)))
+	}
+	return parseGrubbyInfo(string(output)), nil
+}
+
+// parseGrubbyInfo parses the key="value" lines of grubby --info. Each entry
+// starts with an index line
+func parseGrubbyInfo(output string) []grubbyEntry {
+	entries := []grubbyEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(value, "\"")
+
+		if key == "index" {
+			entries = append(entries, grubbyEntry{})
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		switch key {
+		case "kernel":
+			entries[len(entries)-1].kernel = value
+		case "args":
+			entries[len(entries)-1].args = strings.Fields(value)
+		}
+	}
+	return entries
+}
+
+// grubMenuEntry is a menuentry of grub.cfg
+type grubMenuEntry struct {
+	// IDs, or titles if there's no ID, of the submenus and the entry
+	path     []string
+	title    string
+	kernel   string
+	args     []string
+	recovery bool
+}
+
+// defaultValue returns the value of GRUB_DEFAULT that selects the entry
+func (e grubMenuEntry) defaultValue() string {
+	return strings.Join(e.path, ">")
+}
+
+func readGrubCfg() (string, error) {
+	for _, path := range grubCfgPaths {
+		content, err := os.ReadFile("/host" + path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return string(content), nil
+	}
+	return "", errors.New("grub.cfg not found")
+}
+
+// parseGrubMenuEntries returns the entries of grub.cfg in the order they're
+// shown in the menu. Blocks are tracked to know the submenu of each entry
+func parseGrubMenuEntries(grubCfg string) []grubMenuEntry {
+	type block struct {
+		id    string
+		entry *grubMenuEntry
 	}
-	menuEntry := strings.TrimSpace(string(output))
-	if menuEntry == "" {
-		return "", fmt.Errorf("kernel entry for version %s not found in GRUB menu", gkc.KernelVersion)
+
+	entries := []grubMenuEntry{}
+	blocks := []block{}
+	submenuPath := func() []string {
+		path := []string{}
+		for _, b := range blocks {
+			if b.id != "" {
+				path = append(path, b.id)
+			}
+		}
+		return path
 	}
-	lines := strings.Split(string(output), "\n")
 
-	// Regular expression to extract the first value within single quotes
-	re := regexp.MustCompile(`menuentry '([^']+)'`)
-	for _, line := range lines {
+	for _, line := range strings.Split(grubCfg, "\n") {
 		line = strings.TrimSpace(line)
-		// Skip lines containing "recovery mode"
-		if strings.Contains(line, "recovery mode") {
+
+		if line == "}" {
+			if len(blocks) == 0 {
+				continue
+			}
+			if entry := blocks[len(blocks)-1].entry; entry != nil {
+				entries = append(entries, *entry)
+			}
+			blocks = blocks[:len(blocks)-1]
 			continue
 		}
-		match := re.FindStringSubmatch(line)
-		if len(match) > 1 {
-			entry := match[1]
-			return fmt.Sprintf("Advanced options for Ubuntu>%s", entry), nil
+
+		if match := grubMenuTitleRegex.FindStringSubmatch(line); match != nil && strings.HasSuffix(line, "{") {
+			id := match[2]
+			if idMatch := grubMenuIDRegex.FindStringSubmatch(line); idMatch != nil {
+				id = idMatch[1]
+			}
+
+			if match[1] == "submenu" {
+				blocks = append(blocks, block{id: id})
+				continue
+			}
+			entry := &grubMenuEntry{
+				path:     append(submenuPath(), id),
+				title:    match[2],
+				recovery: strings.Contains(id, "recovery") || strings.Contains(match[2], "recovery mode"),
+			}
+			blocks = append(blocks, block{entry: entry})
+			continue
+		}
+
+		if strings.HasSuffix(line, "{") {
+			blocks = append(blocks, block{})
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.HasPrefix(fields[0], "linux") && len(blocks) != 0 {
+			if entry := blocks[len(blocks)-1].entry; entry != nil {
+				entry.kernel = fields[1]
+				entry.args = fields[2:]
+			}
+		}
+	}
+
+	return entries
+}
+
+// findKernelEntry finds the menu entry that boots the specified kernel,
+// skipping the recovery entries.
+func findKernelEntry(entries []grubMenuEntry, kernelVersion string) (grubMenuEntry, error) {
+	for _, entry := range entries {
+		if entry.recovery {
+			continue
+		}
+		if strings.HasSuffix(entry.kernel, "/vmlinuz-"+kernelVersion) {
+			return entry, nil
+		}
+	}
+	return grubMenuEntry{}, fmt.Errorf("kernel entry for version %s not found in GRUB menu", kernelVersion)
+}
+
+// grubDefaultsContent returns the file sourced by grub-mkconfig. Arguments
+// are removed from both GRUB_CMDLINE_LINUX and GRUB_CMDLINE_LINUX_DEFAULT, as
+// distributions set them in either one
+func grubDefaultsContent(grubKernel GrubKernel, menuEntry string) string {
+	lines := []string{grubKernelBeginMarker}
+	if len(grubKernel.CmdlineArgs) > 0 {
+		lines = append(lines, fmt.Sprintf("GRUB_CMDLINE_LINUX=\"%s\"", strings.Join(grubKernel.CmdlineArgs, " ")))
+	}
+	if len(grubKernel.AddArgs) > 0 {
+		lines = append(lines, fmt.Sprintf("GRUB_CMDLINE_LINUX=\"$GRUB_CMDLINE_LINUX %s\"", strings.Join(grubKernel.AddArgs, " ")))
+	}
+	if len(grubKernel.RemoveArgs) > 0 {
+		patterns := []string{}
+		for _, arg := range grubKernel.RemoveArgs {
+			patterns = append(patterns, arg)
+			if !strings.Contains(arg, "=") {
+				patterns = append(patterns, arg+"=*")
+			}
+		}
+		for _, variable := range []string{"GRUB_CMDLINE_LINUX", "GRUB_CMDLINE_LINUX_DEFAULT"} {
+			lines = append(lines,
+				"_nco_args=\"\"",
+				"for _nco_arg in $"+variable+"; do",
+				"\tcase \"$_nco_arg\" in",
+				"\t\t"+strings.Join(patterns, "|")+") ;;",
+				"\t\t*) _nco_args=\"$_nco_args $_nco_arg\" ;;",
+				"\tesac",
+				"done",
+				variable+"=\"${_nco_args# }\"",
+			)
+		}
+	}
+	if menuEntry != "" {
+		lines = append(lines, fmt.Sprintf("GRUB_DEFAULT=\"%s\"", menuEntry))
+	}
+	lines = append(lines, grubKernelEndMarker)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// matchesKernelArg checks if the argument matches the one to remove. An
+// argument to remove without a value matches any value
+func matchesKernelArg(arg, remove string) bool {
+	if arg == remove {
+		return true
+	}
+	return !strings.Contains(remove, "=") && strings.HasPrefix(arg, remove+"=")
+}
+
+func matchesAnyKernelArg(arg string, remove []string) bool {
+	return slices.ContainsFunc(remove, func(r string) bool {
+		return matchesKernelArg(arg, r)
+	})
+}
+
+// kernelArgsDiff returns the arguments missing from the command line and the
+// ones that should have been removed
+func kernelArgsDiff(cmdline, add, remove []string) []string {
+	diff := []string{}
+	for _, arg := range add {
+		if !slices.Contains(cmdline, arg) {
+			diff = append(diff, "missing "+arg)
+		}
+	}
+	for _, arg := range cmdline {
+		if matchesAnyKernelArg(arg, remove) {
+			diff = append(diff, "unexpected "+arg)
 		}
 	}
-	return "", fmt.Errorf("kernel entry for version %s not found in GRUB menu", gkc.KernelVersion)
+	return diff
 }
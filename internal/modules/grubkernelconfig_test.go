@@ -0,0 +1,207 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testGrubCfg = `function gfxmode {
+	set gfxpayload="${1}"
+}
+menuentry 'Ubuntu' --class ubuntu --class os $menuentry_id_option 'gnulinux-simple-1234' {
+	recordfail
+	linux	/boot/vmlinuz-5.15.0-92-generic root=UUID=1234 ro  quiet splash $vt_handoff
+	initrd	/boot/initrd.img-5.15.0-92-generic
+}
+submenu 'Advanced options for Ubuntu' $menuentry_id_option 'gnulinux-advanced-1234' {
+	menuentry 'Ubuntu, with Linux 5.15.0-92-generic' --class ubuntu $menuentry_id_option 'gnulinux-5.15.0-92-generic-advanced-1234' {
+		linux	/boot/vmlinuz-5.15.0-92-generic root=UUID=1234 ro  quiet splash $vt_handoff
+	}
+	menuentry 'Ubuntu, with Linux 5.15.0-91-generic (recovery mode)' --class ubuntu $menuentry_id_option 'gnulinux-5.15.0-91-generic-recovery-1234' {
+		linux	/boot/vmlinuz-5.15.0-91-generic root=UUID=1234 ro recovery nomodeset
+	}
+	menuentry 'Ubuntu, with Linux 5.15.0-91-generic' --class ubuntu $menuentry_id_option 'gnulinux-5.15.0-91-generic-advanced-1234' {
+		if [ x$feature_all_video_module = xy ]; then
+			insmod all_video
+		fi
+		linux	/boot/vmlinuz-5.15.0-91-generic root=UUID=1234 ro  quiet splash $vt_handoff
+	}
+}
+menuentry 'UEFI Firmware Settings' $menuentry_id_option 'uefi-firmware' {
+	fwsetup
+}
+`
+
+func TestParseGrubMenuEntries(t *testing.T) {
+	entries := parseGrubMenuEntries(testGrubCfg)
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(entries))
+	}
+	if entries[0].defaultValue() != "gnulinux-simple-1234" {
+		t.Errorf("unexpected first entry: %s", entries[0].defaultValue())
+	}
+	if !reflect.DeepEqual(entries[0].args, []string{"root=UUID=1234", "ro", "quiet", "splash", "$vt_handoff"}) {
+		t.Errorf("unexpected args: %v", entries[0].args)
+	}
+
+	entry, err := findKernelEntry(entries, "5.15.0-91-generic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.defaultValue() != "gnulinux-advanced-1234>gnulinux-5.15.0-91-generic-advanced-1234" {
+		t.Errorf("unexpected entry: %s", entry.defaultValue())
+	}
+
+	if _, err := findKernelEntry(entries, "5.15.0-9"); err == nil {
+		t.Error("expected error for a partial kernel version")
+	}
+}
+
+func TestGrubDefaultsContent(t *testing.T) {
+	// Files written before addArgs and removeArgs are kept
+	content := grubDefaultsContent(GrubKernel{CmdlineArgs: []string{"quiet", "splash"}}, "gnulinux-advanced-1234>gnulinux-5.15.0-91-generic-advanced-1234")
+	expected := `# BEGIN MARKER NCO GRUB CONFIG
+GRUB_CMDLINE_LINUX="quiet splash"
+GRUB_DEFAULT="gnulinux-advanced-1234>gnulinux-5.15.0-91-generic-advanced-1234"
+# END MARKER NCO GRUB CONFIG
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	content = grubDefaultsContent(GrubKernel{AddArgs: []string{"iommu=pt"}, RemoveArgs: []string{"console", "quiet=1"}}, "")
+	expected = `# BEGIN MARKER NCO GRUB CONFIG
+GRUB_CMDLINE_LINUX="$GRUB_CMDLINE_LINUX iommu=pt"
+_nco_args=""
+for _nco_arg in $GRUB_CMDLINE_LINUX; do
+	case "$_nco_arg" in
+		console|console=*|quiet=1) ;;
+		*) _nco_args="$_nco_args $_nco_arg" ;;
+	esac
+done
+GRUB_CMDLINE_LINUX="${_nco_args# }"
+_nco_args=""
+for _nco_arg in $GRUB_CMDLINE_LINUX_DEFAULT; do
+	case "$_nco_arg" in
+		console|console=*|quiet=1) ;;
+		*) _nco_args="$_nco_args $_nco_arg" ;;
+	esac
+done
+GRUB_CMDLINE_LINUX_DEFAULT="${_nco_args# }"
+# END MARKER NCO GRUB CONFIG
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestKernelArgsDiff(t *testing.T) {
+	cmdline := []string{"BOOT_IMAGE=/vmlinuz", "ro", "console=ttyS0,115200", "quiet"}
+
+	diff := kernelArgsDiff(cmdline, []string{"ro", "iommu=pt"}, []string{"console", "splash"})
+	if !reflect.DeepEqual(diff, []string{"missing iommu=pt", "unexpected console=ttyS0,115200"}) {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+
+	if diff := kernelArgsDiff(cmdline, []string{"quiet"}, []string{"console=tty0"}); len(diff) != 0 {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+}
+
+func TestParseGrubbyInfo(t *testing.T) {
+	output := `index=0
+kernel="/boot/vmlinuz-5.14.0-427.el9.x86_64"
+args="ro crashkernel=1G-4G:192M resume=/dev/mapper/rhel-swap rhgb quiet"
+root="/dev/mapper/rhel-root"
+index=1
+kernel="/boot/vmlinuz-0-rescue-1234"
+args="ro rhgb"
+`
+	entries := parseGrubbyInfo(output)
+	expected := []grubbyEntry{
+		{
+			kernel: "/boot/vmlinuz-5.14.0-427.el9.x86_64",
+			args:   []string{"ro", "crashkernel=1G-4G:192M", "resume=/dev/mapper/rhel-swap", "rhgb", "quiet"},
+		},
+		{kernel: "/boot/vmlinuz-0-rescue-1234", args: []string{"ro", "rhgb"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestGrubbyState(t *testing.T) {
+	state := grubbyState{
+		added: []string{"iommu=pt"},
+		removed: []grubbyArg{
+			{kernel: "/boot/vmlinuz-5.14.0-427.el9.x86_64", arg: "rhgb"},
+			{kernel: "/boot/vmlinuz-5.14.0-427.el9.x86_64", arg: "console=ttyS0,115200"},
+		},
+		defaultKernel: "/boot/vmlinuz-5.14.0-427.el9.x86_64",
+	}
+	if parsed := parseGrubbyState(state.content()); !reflect.DeepEqual(parsed, state) {
+		t.Errorf("unexpected state: %+v", parsed)
+	}
+}
+
+func TestGrubbyRemoveDiff(t *testing.T) {
+	entries := []grubbyEntry{
+		{kernel: "/boot/vmlinuz-1", args: []string{"ro", "rhgb", "iommu=pt"}},
+		{kernel: "/boot/vmlinuz-2", args: []string{"ro", "quiet"}},
+	}
+	state := grubbyState{
+		added: []string{"iommu=pt"},
+		removed: []grubbyArg{
+			{kernel: "/boot/vmlinuz-2", arg: "rhgb"},
+			{kernel: "/boot/vmlinuz-2", arg: "console=ttyS0"},
+			{kernel: "/boot/vmlinuz-3", arg: "rhgb"},
+		},
+	}
+
+	// console=ttyS0 is no longer removed, so it's only restored in the entry
+	// that had it, and the entry of vmlinuz-3 no longer exists
+	toRemove, toRestore, removed := grubbyRemoveDiff(entries, state, []string{"rhgb", "iommu"})
+	if !reflect.DeepEqual(toRemove, []string{"rhgb", "iommu=pt"}) {
+		t.Errorf("unexpected args to remove: %v", toRemove)
+	}
+	if !reflect.DeepEqual(toRestore, []grubbyArg{{kernel: "/boot/vmlinuz-2", arg: "console=ttyS0"}}) {
+		t.Errorf("unexpected args to restore: %v", toRestore)
+	}
+	expected := []grubbyArg{
+		{kernel: "/boot/vmlinuz-1", arg: "rhgb"},
+		{kernel: "/boot/vmlinuz-2", arg: "rhgb"},
+	}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("unexpected removed args: %v", removed)
+	}
+
+	// quiet was already in one of the entries, so it's added to the other but
+	// not owned by the operator
+	toAdd, _, added := grubbyArgsDiff(entries, nil, []string{"quiet", "nosmt"})
+	if !reflect.DeepEqual(toAdd, []string{"quiet", "nosmt"}) {
+		t.Errorf("unexpected args to add: %v", toAdd)
+	}
+	if !reflect.DeepEqual(added, []string{"nosmt"}) {
+		t.Errorf("unexpected added args: %v", added)
+	}
+}
+
+func TestGrubKernelIsPresent(t *testing.T) {
+	for _, grubKernel := range []GrubKernel{
+		{State: "present", CmdlineArgs: []string{"quiet"}},
+		{State: "present", AddArgs: []string{"iommu=pt"}},
+		{State: "present", RemoveArgs: []string{"rhgb"}},
+		{State: "present", KernelVersion: "5.15.0-91-generic"},
+	} {
+		if !grubKernel.IsPresent() {
+			t.Errorf("%+v must be present", grubKernel)
+		}
+	}
+
+	if (GrubKernel{State: "present"}).IsPresent() {
+		t.Error("grub kernel config without settings must not be present")
+	}
+	if (GrubKernel{State: "absent", AddArgs: []string{"iommu=pt"}}).IsPresent() {
+		t.Error("absent grub kernel config must not be present")
+	}
+}
@@ -2,7 +2,14 @@ package modules
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
 
 	"github.com/go-logr/logr"
 )
@@ -10,34 +17,51 @@ import (
 // +kubebuilder:object:generate=true
 type Hosts struct {
 	Hosts []Host `json:"hosts,omitempty"`
+	// Hostname of the node, set with hostnamectl. Requires HOSTFS_ENABLED
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 }
 
 // IsPresent method checks if the module is present
 func (h Hosts) IsPresent() bool {
-	if len(h.Hosts) != 0 && h.State == "present" {
+	if (len(h.Hosts) != 0 || h.Hostname != "") && h.State == "present" {
 		return true
 	}
 	return false
 }
 
+// +kubebuilder:object:generate=true
 type Host struct {
 	Hostname string `json:"hostname"`
-	IP       string `json:"ip"`
+	// IPv4 or IPv6 address of the host
+	IP string `json:"ip"`
+	// Additional names of the host
+	// +optional
+	Aliases []string `json:"aliases,omitempty"`
+	// Comment added at the end of the line
+	// +optional
+	Comment string `json:"comment,omitempty"`
 }
 
 type HostModuleConfig struct {
 	Hosts
-	logger   logr.Logger
-	filePath string
+	logger      logr.Logger
+	filePath    string
+	beginMarker string
+	endMarker   string
 }
 
-func NewHostModuleConfig(hosts Hosts, log logr.Logger) HostModuleConfig {
+func NewHostModuleConfig(hosts Hosts, log logr.Logger, name string) HostModuleConfig {
+	// Each NodeConfig uses its own markers so blocks from different
+	// resources don't overwrite each other
 	return HostModuleConfig{
-		Hosts:    hosts,
-		logger:   log,
-		filePath: "/etc/host/hosts",
+		Hosts:       hosts,
+		logger:      log,
+		filePath:    "/etc/host/hosts",
+		beginMarker: fmt.Sprintf("# BEGIN MARKER NCO %s", name),
+		endMarker:   fmt.Sprintf("# END MARKER NCO %s", name),
 	}
 }
 
@@ -63,26 +87,159 @@ func (c HostModuleConfig) Reconcile() error {
 }
 
 func (c HostModuleConfig) applyModule() error {
-	blocks := [][]byte{}
+	if err := c.removeLegacyBlock(); err != nil {
+		return err
+	}
 
+	blocks := [][]byte{}
 	for _, host := range c.Hosts.Hosts {
-		blocks = append(blocks, []byte(fmt.Sprintf("%s %s", host.IP, host.Hostname)))
+		line, err := formatHostLine(host)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, []byte(line))
 	}
 
-	block := bytes.Join(blocks, []byte("\n"))
+	if len(blocks) != 0 {
+		block := bytes.Join(blocks, []byte("\n"))
+		err := writeBlockToFile(c.filePath, []byte(c.beginMarker), []byte(c.endMarker), block)
+		if err != nil {
+			return fmt.Errorf("failed to write block to file: %w", err)
+		}
+	} else {
+		err := deleteBlockFromFile(c.filePath, []byte(c.beginMarker), []byte(c.endMarker))
+		if err != nil {
+			return fmt.Errorf("failed to delete from file: %w", err)
+		}
+	}
 
-	err := writeBlockToFile(c.filePath, []byte{}, []byte{}, block)
-	if err != nil {
-		return fmt.Errorf("failed to write block to file: %w", err)
+	if c.Hostname != "" {
+		return c.applyHostname()
 	}
 
 	return nil
 }
 
 func (c HostModuleConfig) removeModule() error {
-	err := deleteBlockFromFile(c.filePath, []byte{}, []byte{})
+	err := deleteBlockFromFile(c.filePath, []byte(c.beginMarker), []byte(c.endMarker))
 	if err != nil {
 		return fmt.Errorf("failed to delete from file: %w", err)
 	}
+
+	// The hostname is kept, as there's no previous value to restore
 	return nil
 }
+
+// removeLegacyBlock deletes the block written with the default markers by the
+// previous version of the module. BlockInFiles uses the same markers, so the
+// block is only deleted if it has the lines the previous version wrote
+func (c HostModuleConfig) removeLegacyBlock() error {
+	content, err := os.ReadFile(c.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if !isLegacyHostsBlock(content, c.Hosts.Hosts) {
+		return nil
+	}
+
+	if err := deleteBlockFromFile(c.filePath, []byte{}, []byte{}); err != nil {
+		return fmt.Errorf("failed to delete previous block: %w", err)
+	}
+	c.logger.Info("deleted hosts block written by the previous version")
+	return nil
+}
+
+// isLegacyHostsBlock checks if the block with the default markers has the
+// "<ip> <hostname>" lines the previous version of the module wrote for the
+// hosts
+func isLegacyHostsBlock(content []byte, hosts []Host) bool {
+	if len(hosts) == 0 {
+		return false
+	}
+
+	lines := []string{}
+	for _, host := range hosts {
+		lines = append(lines, fmt.Sprintf("%s %s", host.IP, host.Hostname))
+	}
+
+	block := []string{}
+	insideBlock := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if !insideBlock && line == "# BEGIN MARKER NCO" {
+			insideBlock = true
+			continue
+		} else if insideBlock && line == "# END MARKER NCO" {
+			return slices.Equal(block, lines)
+		}
+		if insideBlock {
+			block = append(block, line)
+		}
+	}
+
+	return false
+}
+
+// applyHostname sets the static hostname with hostnamectl if /etc/hostname
+// doesn't contain it
+func (c HostModuleConfig) applyHostname() error {
+	if os.Getenv("HOSTFS_ENABLED") != "true" {
+		return errors.New("managing the hostname needs HOSTFS_ENABLED set to true")
+	}
+
+	if !hostnameRegexp.MatchString(c.Hostname) {
+		return fmt.Errorf("invalid hostname %s", c.Hostname)
+	}
+
+	content, err := os.ReadFile("/host/etc/hostname")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read hostname: %w", err)
+	}
+	if strings.TrimSpace(string(content)) == c.Hostname {
+		return nil
+	}
+
+	c.logger.Info("setting hostname", "hostname", c.Hostname)
+	output, err := execHostNamespace("hostnamectl", "set-hostname", c.Hostname)
+	if err != nil {
+		return fmt.Errorf("failed to set hostname: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+var hostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+// formatHostLine validates the host and returns its line in /etc/hosts
+func formatHostLine(host Host) (string, error) {
+	ip := net.ParseIP(host.IP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", host.IP)
+	}
+
+	// hostname can contain multiple names separated by spaces
+	names := append(strings.Fields(host.Hostname), host.Aliases...)
+	if len(names) == 0 {
+		return "", fmt.Errorf("no hostname set for %s", host.IP)
+	}
+	// Names in /etc/hosts aren't held to the hostname rules, so they can have
+	// underscores, but whitespace, "#" and control characters would break the
+	// line
+	for _, name := range names {
+		invalid := strings.ContainsFunc(name, func(char rune) bool {
+			return char == '#' || unicode.IsSpace(char) || unicode.IsControl(char)
+		})
+		if name == "" || invalid {
+			return "", fmt.Errorf("invalid hostname %q", name)
+		}
+	}
+
+	line := fmt.Sprintf("%s %s", ip.String(), strings.Join(names, " "))
+	if host.Comment != "" {
+		line = fmt.Sprintf("%s # %s", line, strings.ReplaceAll(host.Comment, "\n", " "))
+	}
+
+	return line, nil
+}
@@ -0,0 +1,67 @@
+package modules
+
+import "testing"
+
+func TestFormatHostLine(t *testing.T) {
+	tests := []struct {
+		host     Host
+		expected string
+	}{
+		{Host{Hostname: "test.whitestack.com", IP: "10.0.0.1"}, "10.0.0.1 test.whitestack.com"},
+		{Host{Hostname: "test3.whitestack.com test4.whitestack.com", IP: "10.0.0.3"}, "10.0.0.3 test3.whitestack.com test4.whitestack.com"},
+		{
+			Host{Hostname: "api.example.com", IP: "2001:DB8::1", Aliases: []string{"api"}, Comment: "control plane"},
+			"2001:db8::1 api.example.com api # control plane",
+		},
+		{Host{Hostname: "db_primary", IP: "10.0.0.4"}, "10.0.0.4 db_primary"},
+	}
+
+	for _, test := range tests {
+		line, err := formatHostLine(test.host)
+		if err != nil {
+			t.Fatalf("unexpected error for %+v: %v", test.host, err)
+		}
+		if line != test.expected {
+			t.Errorf("formatHostLine(%+v) = %q, expected %q", test.host, line, test.expected)
+		}
+	}
+
+	invalid := []Host{
+		{Hostname: "test", IP: "10.0.0.256"},
+		{Hostname: "test", IP: "2001:db8::g"},
+		{Hostname: "", IP: "10.0.0.1"},
+		{Hostname: "bad#name", IP: "10.0.0.1"},
+		{Hostname: "test", IP: "10.0.0.1", Aliases: []string{"bad alias"}},
+		{Hostname: "test", IP: "10.0.0.1", Aliases: []string{""}},
+		{Hostname: "test", IP: "10.0.0.1", Aliases: []string{"bad\x00alias"}},
+	}
+	for _, host := range invalid {
+		if _, err := formatHostLine(host); err == nil {
+			t.Errorf("expected error for %+v", host)
+		}
+	}
+}
+
+func TestIsLegacyHostsBlock(t *testing.T) {
+	hosts := []Host{
+		{Hostname: "test.whitestack.com", IP: "10.0.0.1", Comment: "new field"},
+		{Hostname: "test2.whitestack.com", IP: "10.0.0.2"},
+	}
+	legacy := "127.0.0.1 localhost\n# BEGIN MARKER NCO\n10.0.0.1 test.whitestack.com\n10.0.0.2 test2.whitestack.com\n# END MARKER NCO\n"
+	if !isLegacyHostsBlock([]byte(legacy), hosts) {
+		t.Error("expected block written by the previous version to match")
+	}
+
+	// Blocks with the default markers written by BlockInFiles are kept
+	other := "127.0.0.1 localhost\n# BEGIN MARKER NCO\n10.0.0.9 other.whitestack.com\n# END MARKER NCO\n"
+	if isLegacyHostsBlock([]byte(other), hosts) {
+		t.Error("expected block with other lines not to match")
+	}
+
+	if isLegacyHostsBlock([]byte("127.0.0.1 localhost\n"), hosts) {
+		t.Error("expected file without block not to match")
+	}
+	if isLegacyHostsBlock([]byte(legacy), nil) {
+		t.Error("expected no match without hosts")
+	}
+}
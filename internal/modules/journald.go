@@ -0,0 +1,205 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// +kubebuilder:object:generate=true
+// Journald defines the storage and retention settings of systemd-journald
+type Journald struct {
+	// Where to store the journal
+	// +kubebuilder:validation:Enum=volatile;persistent;auto;none
+	// +optional
+	Storage string `json:"storage,omitempty"`
+	// Maximum disk space used by the persistent journal (e.g. 2G)
+	// +kubebuilder:validation:Pattern=`^[0-9]+[KMGTPE]?$`
+	// +optional
+	SystemMaxUse string `json:"systemMaxUse,omitempty"`
+	// Disk space to keep free for other uses (e.g. 10G)
+	// +kubebuilder:validation:Pattern=`^[0-9]+[KMGTPE]?$`
+	// +optional
+	SystemKeepFree string `json:"systemKeepFree,omitempty"`
+	// Maximum size of each journal file (e.g. 128M)
+	// +kubebuilder:validation:Pattern=`^[0-9]+[KMGTPE]?$`
+	// +optional
+	SystemMaxFileSize string `json:"systemMaxFileSize,omitempty"`
+	// Maximum memory used by the volatile journal (e.g. 256M)
+	// +kubebuilder:validation:Pattern=`^[0-9]+[KMGTPE]?$`
+	// +optional
+	RuntimeMaxUse string `json:"runtimeMaxUse,omitempty"`
+	// Maximum time to keep journal entries (e.g. 2week or 1month)
+	// +kubebuilder:validation:Pattern=`^[0-9]+ ?[a-z]*$`
+	// +optional
+	MaxRetentionSec string `json:"maxRetentionSec,omitempty"`
+	// Compress the journal entries
+	// +optional
+	Compress *bool `json:"compress,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority to set for this configuration (default: 50)
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=50
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (j Journald) IsPresent() bool {
+	if len(journaldSettings(j)) != 0 && j.State == "present" {
+		return true
+	}
+	return false
+}
+
+type JournaldConfig struct {
+	Journald
+	*statusRecorder
+	logger   logr.Logger
+	filePath string
+}
+
+func NewJournaldConfig(journald Journald, logger logr.Logger, name string) JournaldConfig {
+	return JournaldConfig{
+		Journald:       journald,
+		statusRecorder: newStatusRecorder("journald"),
+		logger:         logger,
+		filePath:       fmt.Sprintf("/host/etc/systemd/journald.conf.d/%d-nco-%s.conf", *journald.Priority, name),
+	}
+}
+
+func (j JournaldConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		j.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"journald", nil}
+	if j.State == "present" {
+		j.logger.V(1).Info("applying module")
+		if err := j.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		j.logger.V(1).Info("module applied")
+	} else if j.State == "absent" {
+		j.logger.V(1).Info("removing module")
+		if err := j.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		j.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (j JournaldConfig) applyModule() error {
+	content := journaldDropInContent(j.Journald)
+	isCurrent, err := checkFileContents(j.filePath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check journald drop-in: %w", err)
+	}
+
+	if !isCurrent {
+		if err := writeFile(j.filePath, content); err != nil {
+			return fmt.Errorf("failed to write journald drop-in: %w", err)
+		}
+		if err := j.restartAction().mark(); err != nil {
+			return err
+		}
+	}
+	if err := j.restartJournald(); err != nil {
+		return err
+	}
+
+	j.recordDiskUsage()
+	return nil
+}
+
+func (j JournaldConfig) removeModule() error {
+	exists, err := checkFileExists(j.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to check journald drop-in: %w", err)
+	}
+	if exists {
+		if err := deleteFileIfExists(j.filePath); err != nil {
+			return fmt.Errorf("failed to delete journald drop-in: %w", err)
+		}
+		if err := j.restartAction().mark(); err != nil {
+			return err
+		}
+	}
+
+	return j.restartJournald()
+}
+
+// restartAction is recorded when the drop-in changes and cleared once
+// journald is restarted, so a failed restart is retried in the next
+// reconciliations
+func (j JournaldConfig) restartAction() pendingAction {
+	return newPendingAction("journald", j.filePath)
+}
+
+func (j JournaldConfig) restartJournald() error {
+	pending := j.restartAction()
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	j.logger.Info("restarting systemd-journald")
+	if output, err := execChroot("systemctl", "restart", "systemd-journald"); err != nil {
+		return fmt.Errorf("failed to restart systemd-journald: %s", strings.TrimSpace(string(output)))
+	}
+	return pending.done()
+}
+
+// recordDiskUsage reports the disk space used by the journal files
+func (j JournaldConfig) recordDiskUsage() {
+	output, err := execChroot("journalctl", "--disk-usage")
+	if err != nil {
+		j.logger.Error(err, "failed to get journal disk usage")
+		return
+	}
+	j.record("", strings.TrimSpace(string(output)))
+}
+
+// journaldSettings returns the settings of the [Journal] section, in a fixed
+// order
+func journaldSettings(journald Journald) [][2]string {
+	settings := [][2]string{}
+	add := func(key, value string) {
+		if value != "" {
+			settings = append(settings, [2]string{key, value})
+		}
+	}
+
+	add("Storage", journald.Storage)
+	add("SystemMaxUse", journald.SystemMaxUse)
+	add("SystemKeepFree", journald.SystemKeepFree)
+	add("SystemMaxFileSize", journald.SystemMaxFileSize)
+	add("RuntimeMaxUse", journald.RuntimeMaxUse)
+	add("MaxRetentionSec", strings.ReplaceAll(journald.MaxRetentionSec, " ", ""))
+	if journald.Compress != nil {
+		add("Compress", fmt.Sprintf("%t", *journald.Compress))
+	}
+
+	return settings
+}
+
+func journaldDropInContent(journald Journald) string {
+	lines := []string{overrideHeader, "[Journal]"}
+	for _, setting := range journaldSettings(journald) {
+		lines = append(lines, setting[0]+"="+setting[1])
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
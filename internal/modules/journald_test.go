@@ -0,0 +1,28 @@
+package modules
+
+import "testing"
+
+func TestJournaldDropInContent(t *testing.T) {
+	compress := false
+	content := journaldDropInContent(Journald{
+		Storage:         "persistent",
+		SystemMaxUse:    "2G",
+		MaxRetentionSec: "1 month",
+		Compress:        &compress,
+	})
+
+	expected := overrideHeader + `
+[Journal]
+Storage=persistent
+SystemMaxUse=2G
+MaxRetentionSec=1month
+Compress=false
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	if (Journald{State: "present"}).IsPresent() {
+		t.Error("journald without settings must not be present")
+	}
+}
@@ -1,16 +1,33 @@
 package modules
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/go-logr/logr"
 )
 
+const sysModulePath = "/sys/module"
+
 // +kubebuilder:object:generate=true
 type KernelModules struct {
 	Modules []string `json:"modules,omitempty"`
+	// Options to set for each kernel module
+	// +optional
+	Options []KernelModuleOptions `json:"options,omitempty"`
+	// List of kernel modules that must not be loaded automatically
+	// +optional
+	Blacklist []string `json:"blacklist,omitempty"`
+	// Regenerate the initramfs when the options or the blacklist change, so
+	// they're also applied to the modules loaded early in the boot
+	// +optional
+	RegenerateInitramfs bool `json:"regenerateInitramfs,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 	// Priority to set for these modules (default: 50)
@@ -23,33 +40,48 @@ type KernelModules struct {
 
 // IsPresent method checks if the module is present
 func (k KernelModules) IsPresent() bool {
-	if len(k.Modules) != 0 && k.State == "present" {
+	isEmpty := len(k.Modules) == 0 && len(k.Options) == 0 && len(k.Blacklist) == 0
+	if !isEmpty && k.State == "present" {
 		return true
 	}
 	return false
 }
 
+// +kubebuilder:object:generate=true
+type KernelModuleOptions struct {
+	// Name of the kernel module (e.g. nf_conntrack)
+	Name string `json:"name"`
+	// Options of the kernel module (e.g. hashsize: "131072")
+	Options map[string]string `json:"options"`
+}
+
 type KernelModule = string
 
 type KernelModuleConfig struct {
 	KernelModules
+	*statusRecorder
 	logger logr.Logger
 	// This file is for loading the kernel modules at boot
 	// by systemd-modules-load
 	filePath     string
 	prevFilePath string
+	// This file contains the options and the blacklist, read by modprobe
+	modprobeFilePath string
 }
 
 func NewKernelModuleConfig(modules KernelModules, log logr.Logger, name string) KernelModuleConfig {
 	folder := "/etc/modules-load.d"
 	filePath := fmt.Sprintf("%s/%d-nco-%s.conf", folder, *modules.Priority, name)
 	prevFilePath := fmt.Sprintf("%s/nco.conf", folder)
+	modprobeFilePath := fmt.Sprintf("/etc/modprobe.d/%d-nco-%s.conf", *modules.Priority, name)
 
 	return KernelModuleConfig{
-		KernelModules: modules,
-		logger:        log,
-		filePath:      filePath,
-		prevFilePath:  prevFilePath,
+		KernelModules:    modules,
+		statusRecorder:   newStatusRecorder("kernelModules"),
+		logger:           log,
+		filePath:         filePath,
+		prevFilePath:     prevFilePath,
+		modprobeFilePath: modprobeFilePath,
 	}
 }
 
@@ -80,6 +112,32 @@ func (c KernelModuleConfig) applyModule() error {
 		return fmt.Errorf("failed to remove file: %w", err)
 	}
 
+	// The options must be in place before the modules are loaded
+	if err := c.applyModprobeConfig(); err != nil {
+		return err
+	}
+
+	if err := c.applyModulesLoad(); err != nil {
+		return err
+	}
+
+	return c.verifyModules()
+}
+
+func (c KernelModuleConfig) applyModulesLoad() error {
+	if len(c.Modules) == 0 {
+		if err := deleteFileIfExists(c.filePath); err != nil {
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
+		return nil
+	}
+
+	for _, module := range c.Modules {
+		if slices.Contains(c.Blacklist, module) {
+			return fmt.Errorf("module %s can't be loaded and blacklisted", module)
+		}
+	}
+
 	isCurrent, err := c.checkCurrentConfig()
 	if err != nil {
 		return fmt.Errorf("failed to check current config: %w", err)
@@ -116,6 +174,19 @@ func (c KernelModuleConfig) removeModule() error {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
+	exists, err := checkFileExists(c.modprobeFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to check file: %w", err)
+	}
+	if exists {
+		if err := deleteFileIfExists(c.modprobeFilePath); err != nil {
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
+	}
+	if err := c.regenerateInitramfs(exists); err != nil {
+		return err
+	}
+
 	// Modules shouldn't be unloaded, next host reboot should fix
 	// the inconsistency
 	c.logger.V(1).Info("finished cleaning up")
@@ -147,3 +218,169 @@ func isModuleActive(moduleName string) bool {
 	err := cmd.Run()
 	return err == nil
 }
+
+// applyModprobeConfig writes the options and the blacklist to modprobe.d and
+// regenerates the initramfs if the file changed
+func (c KernelModuleConfig) applyModprobeConfig() error {
+	if len(c.Options) == 0 && len(c.Blacklist) == 0 {
+		exists, err := checkFileExists(c.modprobeFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to check file: %w", err)
+		}
+		if exists {
+			if err := deleteFileIfExists(c.modprobeFilePath); err != nil {
+				return fmt.Errorf("failed to delete file: %w", err)
+			}
+		}
+		return c.regenerateInitramfs(exists)
+	}
+
+	content := modprobeConfigContent(c.Options, c.Blacklist)
+	isCurrent, err := checkFileContents(c.modprobeFilePath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check current config: %w", err)
+	}
+
+	if !isCurrent {
+		if err := writeFile(c.modprobeFilePath, content); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+
+	return c.regenerateInitramfs(!isCurrent)
+}
+
+// regenerateInitramfs runs update-initramfs on Debian based hosts and dracut
+// on the rest. The regeneration is recorded as pending when the modprobe.d
+// file changed, so a failed regeneration is retried in the next
+// reconciliations while the file is kept
+func (c KernelModuleConfig) regenerateInitramfs(changed bool) error {
+	if !c.RegenerateInitramfs {
+		return nil
+	}
+
+	if os.Getenv("HOSTFS_ENABLED") != "true" {
+		return errors.New("regenerating the initramfs needs HOSTFS_ENABLED set to true")
+	}
+
+	pending := newPendingAction("kernelModules", c.modprobeFilePath)
+	if changed {
+		if err := pending.mark(); err != nil {
+			return err
+		}
+	}
+	isPending, err := pending.isPending()
+	if err != nil {
+		return err
+	}
+	if !isPending {
+		return nil
+	}
+
+	args := []string{"dracut", "-f"}
+	isDebian, err := checkFileExists("/host/usr/sbin/update-initramfs")
+	if err != nil {
+		return fmt.Errorf("failed to check initramfs tool: %w", err)
+	}
+	if isDebian {
+		args = []string{"update-initramfs", "-u"}
+	}
+
+	c.logger.Info("regenerating initramfs", "command", args[0])
+	output, err := execChroot(args...)
+	if err != nil {
+		c.recordWarning("initramfs", "failed to regenerate initramfs, it will be retried")
+		return fmt.Errorf("failed to regenerate initramfs: %s", strings.TrimSpace(string(output)))
+	}
+
+	c.record("initramfs", "initramfs regenerated")
+	return pending.done()
+}
+
+// verifyModules compares the options of the loaded modules with the desired
+// ones and reports the modules that need a reboot to apply them
+func (c KernelModuleConfig) verifyModules() error {
+	for _, module := range c.Options {
+		sysName := strings.ReplaceAll(module.Name, "-", "_")
+		if _, err := os.Stat(filepath.Join(sysModulePath, sysName)); err != nil {
+			// options are applied the next time the module is loaded
+			continue
+		}
+
+		for _, key := range sortedKeys(module.Options) {
+			value := module.Options[key]
+			paramPath := filepath.Join(sysModulePath, sysName, "parameters", key)
+			current, err := os.ReadFile(paramPath)
+			if errors.Is(err, os.ErrNotExist) {
+				c.record(module.Name, fmt.Sprintf("parameter %s is not exposed in sysfs", key))
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to read parameter %s of module %s: %w", key, module.Name, err)
+			}
+
+			currentValue := strings.TrimSpace(string(current))
+			if !moduleParameterEqual(currentValue, value) {
+				c.recordRebootRequired(module.Name, fmt.Sprintf(
+					"parameter %s is %s, expected %s", key, currentValue, value))
+			}
+		}
+	}
+
+	for _, module := range c.Blacklist {
+		sysName := strings.ReplaceAll(module, "-", "_")
+		if _, err := os.Stat(filepath.Join(sysModulePath, sysName, "initstate")); err == nil {
+			c.recordRebootRequired(module, "module is blacklisted but loaded")
+		}
+	}
+
+	return nil
+}
+
+// modprobeConfigContent returns the modprobe.d lines for the options and the
+// blacklist, sorted so the file doesn't change between reconciliations
+func modprobeConfigContent(options []KernelModuleOptions, blacklist []string) string {
+	lines := []string{}
+	for _, module := range options {
+		if len(module.Options) == 0 {
+			continue
+		}
+
+		values := []string{}
+		for _, key := range sortedKeys(module.Options) {
+			values = append(values, fmt.Sprintf("%s=%s", key, module.Options[key]))
+		}
+		lines = append(lines, fmt.Sprintf("options %s %s", module.Name, strings.Join(values, " ")))
+	}
+
+	for _, module := range blacklist {
+		lines = append(lines, fmt.Sprintf("blacklist %s", module))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// moduleParameterEqual compares a parameter from sysfs with the desired
+// value. Boolean parameters are shown as Y or N in sysfs
+func moduleParameterEqual(current, desired string) bool {
+	if current == desired {
+		return true
+	}
+
+	switch current {
+	case "Y":
+		return slices.Contains([]string{"1", "y", "true", "on"}, strings.ToLower(desired))
+	case "N":
+		return slices.Contains([]string{"0", "n", "false", "off"}, strings.ToLower(desired))
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
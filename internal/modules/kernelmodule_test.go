@@ -0,0 +1,41 @@
+package modules
+
+import "testing"
+
+func TestModprobeConfigContent(t *testing.T) {
+	options := []KernelModuleOptions{
+		{Name: "nf_conntrack", Options: map[string]string{"hashsize": "131072", "expect_hashsize": "1024"}},
+		{Name: "empty"},
+	}
+	content := modprobeConfigContent(options, []string{"nouveau", "floppy"})
+
+	expected := `options nf_conntrack expect_hashsize=1024 hashsize=131072
+blacklist nouveau
+blacklist floppy
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestModuleParameterEqual(t *testing.T) {
+	tests := []struct {
+		current  string
+		desired  string
+		expected bool
+	}{
+		{"131072", "131072", true},
+		{"65536", "131072", false},
+		{"Y", "1", true},
+		{"Y", "true", true},
+		{"N", "0", true},
+		{"N", "Y", false},
+		{"Y", "off", false},
+	}
+
+	for _, test := range tests {
+		if got := moduleParameterEqual(test.current, test.desired); got != test.expected {
+			t.Errorf("moduleParameterEqual(%q, %q) = %v, expected %v", test.current, test.desired, got, test.expected)
+		}
+	}
+}
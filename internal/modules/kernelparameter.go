@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -30,15 +31,26 @@ func (k KernelParameters) IsPresent() bool {
 	return false
 }
 
+// +kubebuilder:object:generate=true
 type KernelParameterKV struct {
 	// Name of the kernel parameter (e.g. fs.file-max)
 	Name string `json:"name,omitempty"`
 	// Desired value of the kernel parameter
 	Value string `json:"value,omitempty"`
+	// Write the parameter to the sysctl.d file so it's kept after a reboot
+	// (default: true). If false, it's only set at runtime
+	// +kubebuilder:default:=true
+	// +optional
+	Persist *bool `json:"persist,omitempty"`
+}
+
+func (k KernelParameterKV) persist() bool {
+	return k.Persist == nil || *k.Persist
 }
 
 type KernelParameterConfig struct {
 	KernelParameters
+	*statusRecorder
 	logger       logr.Logger
 	filePath     string
 	prevFilePath string
@@ -51,6 +63,7 @@ func NewKernelParameterConfig(configs KernelParameters, log logr.Logger, name st
 
 	return KernelParameterConfig{
 		KernelParameters: configs,
+		statusRecorder:   newStatusRecorder("kernelParameters"),
 		logger:           log,
 		filePath:         filePath,
 		prevFilePath:     "/etc/sysctl.d/99-nco.conf",
@@ -85,35 +98,67 @@ func (c KernelParameterConfig) applyModule() error {
 		return fmt.Errorf("failed to remove prevFilePath: %w", err)
 	}
 
-	// check current configuration
-	newParameters := make([]string, len(c.Parameters))
-	for i, parameters := range c.Parameters {
-		newParameters[i] = parameters.Name + " = " + parameters.Value
+	// only persisted parameters are written to the config file
+	newParameters := []string{}
+	for _, parameter := range c.Parameters {
+		if parameter.persist() {
+			newParameters = append(newParameters, parameter.Name+" = "+parameter.Value)
+		}
 	}
 
-	isCurrent, err := c.checkCurrentConfig(newParameters)
-	if err != nil {
-		return fmt.Errorf("failed to check current configuration: %w", err)
+	reload := false
+	if len(newParameters) == 0 {
+		if err := deleteFileIfExists(c.filePath); err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+	} else {
+		isCurrent, err := checkFileContents(c.filePath, strings.Join(newParameters, "\n"))
+		if err != nil {
+			return fmt.Errorf("failed to check current configuration: %w", err)
+		}
+		if !isCurrent {
+			// generate a config file from all configs
+			if err := writeFile(c.filePath, strings.Join(newParameters, "\n")); err != nil {
+				return fmt.Errorf("failed to write file: %w", err)
+			}
+			reload = true
+		}
 	}
 
-	if isCurrent {
-		// do nothing
-		return nil
-	}
+	// check if each parameter is currently applied
+	for _, parameter := range c.Parameters {
+		currentValue, err := readSysctl(parameter.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			// reported in the status
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if sysctlValuesEqual(currentValue, parameter.Value) {
+			continue
+		}
 
-	// generate a config file from all configs
-	err = writeFile(c.filePath, strings.Join(newParameters, "\n"))
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		if parameter.persist() {
+			reload = true
+			continue
+		}
+		if err := os.WriteFile(sysctlPath(parameter.Name), []byte(parameter.Value), 0644); err != nil {
+			return fmt.Errorf("failed to set sysctl %s: %w", parameter.Name, err)
+		}
+		c.logger.Info("kernel parameter set at runtime", "name", parameter.Name)
 	}
 
-	cmd := exec.Command("sysctl", "-p", c.filePath)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("Error applying sysctl config: %s", err)
+	if reload {
+		// -e ignores the parameters that don't exist on this kernel
+		output, err := exec.Command("sysctl", "-e", "-p", c.filePath).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Error applying sysctl config: %s", strings.TrimSpace(string(output)))
+		}
+		c.logger.Info("sysctl config applied", "path", c.filePath)
 	}
 
-	return nil
+	return c.recordParameters()
 }
 
 func (c KernelParameterConfig) removeModule() error {
@@ -138,42 +183,69 @@ func (c KernelParameterConfig) removeModule() error {
 	return nil
 }
 
-func (c KernelParameterConfig) checkCurrentConfig(newConfigLines []string) (bool, error) {
-	isFileEqual, err := checkFileContents(c.filePath, strings.Join(newConfigLines, "\n"))
-	if err != nil {
-		return false, err
-	}
-
-	if !isFileEqual {
-		return false, nil
-	}
-
-	// check if each new config is currently applied
-	for _, config := range c.Parameters {
-		// check and compare value
-		isEqual, err := isSysctlEqual(config.Name, config.Value)
+// recordParameters reports the current value of each parameter, with a
+// warning if it's not the desired one or the kernel doesn't have it
+func (c KernelParameterConfig) recordParameters() error {
+	for _, parameter := range c.Parameters {
+		currentValue, err := readSysctl(parameter.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			c.recordWarning(parameter.Name, "parameter doesn't exist on this kernel")
+			continue
+		}
 		if err != nil {
-			// This parameter is incorrect
-			return false, err
-		} else if !isEqual {
-			return false, nil
+			return err
+		}
+
+		currentValue = normalizeSysctlValue(currentValue)
+		if sysctlValuesEqual(currentValue, parameter.Value) {
+			c.record(parameter.Name, currentValue)
+		} else {
+			c.recordWarning(parameter.Name, fmt.Sprintf("desired %q, actual %q", normalizeSysctlValue(parameter.Value), currentValue))
 		}
 	}
-	return true, nil
+	return nil
 }
 
-func isSysctlEqual(parameter string, desiredValue string) (bool, error) {
-	suffix := strings.ReplaceAll(parameter, ".", "/")
-	filePath := "/proc/sys/" + suffix
-
-	// Read the content of the file
-	content, err := os.ReadFile(filePath)
+func readSysctl(parameter string) (string, error) {
+	content, err := os.ReadFile(sysctlPath(parameter))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
 	if err != nil {
-		return false, fmt.Errorf("Could not read sysctl %s : %w", parameter, err)
+		return "", fmt.Errorf("Could not read sysctl %s : %w", parameter, err)
 	}
+	return string(content), nil
+}
 
-	// Convert content to string
-	currentValue := strings.TrimSpace(string(content))
+// sysctlPath returns the /proc/sys file of the parameter, following the
+// naming of sysctl: if the first separator is a slash, dots are part of the
+// names (e.g. net/ipv4/conf/eth0.100/rp_filter). Otherwise dots separate the
+// names and slashes are dots within a name (e.g. net.ipv4.conf.eth0/100.rp_filter)
+func sysctlPath(parameter string) string {
+	firstSlash := strings.Index(parameter, "/")
+	firstDot := strings.Index(parameter, ".")
+	if firstSlash != -1 && (firstDot == -1 || firstSlash < firstDot) {
+		return "/proc/sys/" + parameter
+	}
+
+	suffix := strings.Map(func(r rune) rune {
+		switch r {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return r
+	}, parameter)
+	return "/proc/sys/" + suffix
+}
+
+// normalizeSysctlValue collapses whitespace, as /proc separates multiple
+// values with tabs (e.g. net.ipv4.ip_local_port_range)
+func normalizeSysctlValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
 
-	return currentValue == desiredValue, nil
+func sysctlValuesEqual(currentValue, desiredValue string) bool {
+	return normalizeSysctlValue(currentValue) == normalizeSysctlValue(desiredValue)
 }
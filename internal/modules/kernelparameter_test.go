@@ -0,0 +1,32 @@
+package modules
+
+import "testing"
+
+func TestSysctlPath(t *testing.T) {
+	tests := map[string]string{
+		"fs.file-max":                       "/proc/sys/fs/file-max",
+		"net.ipv4.conf.eth0/100.rp_filter":  "/proc/sys/net/ipv4/conf/eth0.100/rp_filter",
+		"net/ipv4/conf/eth0.100/rp_filter":  "/proc/sys/net/ipv4/conf/eth0.100/rp_filter",
+		"net.ipv6.conf.ens3.accept_ra":      "/proc/sys/net/ipv6/conf/ens3/accept_ra",
+		"net/ipv6/conf/br-ex/disable_ipv6":  "/proc/sys/net/ipv6/conf/br-ex/disable_ipv6",
+		"net.ipv4.neigh.default.gc_thresh3": "/proc/sys/net/ipv4/neigh/default/gc_thresh3",
+	}
+
+	for parameter, expected := range tests {
+		if path := sysctlPath(parameter); path != expected {
+			t.Errorf("sysctlPath(%q) = %s, expected %s", parameter, path, expected)
+		}
+	}
+}
+
+func TestSysctlValuesEqual(t *testing.T) {
+	if !sysctlValuesEqual("1024\t65000\n", "1024 65000") {
+		t.Error("values separated by tabs must be equal")
+	}
+	if !sysctlValuesEqual("4096\t87380\t6291456\n", " 4096  87380 6291456") {
+		t.Error("values with extra spaces must be equal")
+	}
+	if sysctlValuesEqual("1024\t65000\n", "1024 60000") {
+		t.Error("different values must not be equal")
+	}
+}
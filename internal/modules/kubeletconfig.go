@@ -0,0 +1,386 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	kubeletconfigv1beta1 "k8s.io/kubelet/config/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kubeletConfigAPIVersion = "kubelet.config.k8s.io/v1beta1"
+	kubeletConfigKind       = "KubeletConfiguration"
+)
+
+// +kubebuilder:object:generate=true
+// KubeletConfig defines settings of the KubeletConfiguration of the node
+type KubeletConfig struct {
+	// Fields of the KubeletConfiguration in YAML (e.g. "maxPods: 200")
+	Config string `json:"config,omitempty"`
+	// Drop-in directory of the kubelet, set with its --config-dir flag
+	// (default: /etc/kubernetes/kubelet.conf.d)
+	// +optional
+	DropInDir string `json:"dropInDir,omitempty"`
+	// Configuration file of the kubelet to patch instead of writing a
+	// drop-in, for kubelets without drop-in support (e.g.
+	// /var/lib/kubelet/config.yaml)
+	// +optional
+	ConfigFile string `json:"configFile,omitempty"`
+	// Seconds to wait for the node to be Ready after restarting the kubelet
+	// (default: 300)
+	// +kubebuilder:validation:Minimum:=30
+	// +kubebuilder:default:=300
+	// +optional
+	ReadyTimeout *int `json:"readyTimeout,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority to set for the drop-in (default: 50)
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=50
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (k KubeletConfig) IsPresent() bool {
+	if k.Config != "" && k.State == "present" {
+		return true
+	}
+	return false
+}
+
+// NodeCoordinator serializes disruptive operations across the nodes of a
+// NodeConfig. It's implemented by the controller so modules don't need a
+// kubernetes client
+type NodeCoordinator interface {
+	// HoldsLock returns true if this node holds the lock of the NodeConfig
+	HoldsLock() (bool, error)
+	// AcquireLock takes or renews the lock, and returns false if another
+	// node holds it
+	AcquireLock() (bool, error)
+	ReleaseLock() error
+	// NodeReady returns true if the node is Ready and its kubelet reported
+	// after the given time
+	NodeReady(since time.Time) (bool, error)
+}
+
+type KubeletConfigConfig struct {
+	KubeletConfig
+	*statusRecorder
+	logger      logr.Logger
+	coordinator NodeCoordinator
+	dropInPath  string
+}
+
+func NewKubeletConfigConfig(kubeletConfig KubeletConfig, logger logr.Logger, coordinator NodeCoordinator, name string) KubeletConfigConfig {
+	dropInDir := kubeletConfig.DropInDir
+	if dropInDir == "" {
+		dropInDir = "/etc/kubernetes/kubelet.conf.d"
+	}
+
+	return KubeletConfigConfig{
+		KubeletConfig:  kubeletConfig,
+		statusRecorder: newStatusRecorder("kubeletConfig"),
+		logger:         logger,
+		coordinator:    coordinator,
+		dropInPath:     fmt.Sprintf("%s/%d-nco-%s.conf", dropInDir, *kubeletConfig.Priority, name),
+	}
+}
+
+func (k KubeletConfigConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		k.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"kubeletConfig", nil}
+	if k.State == "present" {
+		k.logger.V(1).Info("applying module")
+		if err := k.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		k.logger.V(1).Info("module applied")
+	} else if k.State == "absent" {
+		k.logger.V(1).Info("removing module")
+		if err := k.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		k.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (k KubeletConfigConfig) applyModule() error {
+	fields, err := parseKubeletConfig(k.Config)
+	if err != nil {
+		return err
+	}
+
+	if k.ConfigFile != "" {
+		original, err := k.originalConfigFile()
+		if err != nil {
+			return err
+		}
+		content, err := mergeKubeletConfig(original, fields)
+		if err != nil {
+			return err
+		}
+		return k.updateKubelet("/host"+k.ConfigFile, content)
+	}
+
+	content, err := kubeletDropInContent(fields)
+	if err != nil {
+		return err
+	}
+	return k.updateKubelet("/host"+k.dropInPath, content)
+}
+
+func (k KubeletConfigConfig) removeModule() error {
+	if k.ConfigFile == "" {
+		return k.updateKubelet("/host"+k.dropInPath, "")
+	}
+
+	backupPath := "/host" + k.ConfigFile + ".nco-backup"
+	backup, err := os.ReadFile(backupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	if err := k.updateKubelet("/host"+k.ConfigFile, string(backup)); err != nil {
+		return err
+	}
+	if err := deleteFileIfExists(backupPath); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	return nil
+}
+
+// originalConfigFile returns the config file before it was patched. A backup
+// is kept, so fields removed from the NodeConfig get their original value
+func (k KubeletConfigConfig) originalConfigFile() (string, error) {
+	backupPath := "/host" + k.ConfigFile + ".nco-backup"
+	backup, err := os.ReadFile(backupPath)
+	if err == nil {
+		return string(backup), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	original, err := os.ReadFile("/host" + k.ConfigFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read kubelet config: %w", err)
+	}
+	if err := writeFileAtomic(backupPath, string(original), 0600); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return string(original), nil
+}
+
+// updateKubelet writes the file, or deletes it if the content is empty, and
+// restarts the kubelet. Only one node of the NodeConfig restarts its kubelet
+// at a time: the lock is released once the node is Ready again, so a kubelet
+// that doesn't recover stops the rollout. A failed restart keeps the lock and
+// is retried on the next reconciliation
+func (k KubeletConfigConfig) updateKubelet(path, content string) error {
+	var isCurrent bool
+	var err error
+	if content == "" {
+		exists, existsErr := checkFileExists(path)
+		isCurrent, err = !exists, existsErr
+	} else {
+		isCurrent, err = checkFileContents(path, content)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+
+	// A restart that failed is retried, as the file is already current
+	restart := newPendingAction("kubeletConfig", path)
+	isPending, err := restart.isPending()
+	if err != nil {
+		return err
+	}
+
+	holdsLock, err := k.coordinator.HoldsLock()
+	if err != nil {
+		return err
+	}
+	if isCurrent && !isPending && !holdsLock {
+		return nil
+	}
+
+	acquired, err := k.coordinator.AcquireLock()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		k.record("", "waiting for another node to restart its kubelet")
+		return errors.New("kubelet restart is waiting for another node")
+	}
+
+	var restartTime time.Time
+	if !isCurrent {
+		if content == "" {
+			err = deleteFileIfExists(path)
+		} else {
+			err = writeFileAtomic(path, content, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", path, err)
+		}
+		if err := restart.mark(); err != nil {
+			return err
+		}
+		isPending = true
+	}
+
+	if isPending {
+		k.logger.Info("restarting kubelet")
+		restartTime = time.Now()
+		if output, err := execChroot("systemctl", "restart", "kubelet"); err != nil {
+			return fmt.Errorf("failed to restart kubelet: %s", strings.TrimSpace(string(output)))
+		}
+		if err := restart.done(); err != nil {
+			return err
+		}
+	}
+
+	if err := k.waitForNodeReady(restartTime); err != nil {
+		return err
+	}
+
+	k.record("", "kubelet configuration applied")
+	return k.coordinator.ReleaseLock()
+}
+
+func (k KubeletConfigConfig) waitForNodeReady(since time.Time) error {
+	timeout := 300
+	if k.ReadyTimeout != nil {
+		timeout = *k.ReadyTimeout
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		ready, err := k.coordinator.NodeReady(since)
+		if err != nil {
+			k.logger.Error(err, "failed to check node status")
+		} else if ready {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("node is not Ready after restarting kubelet, the rollout is stopped")
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// parseKubeletConfig parses the fields of the KubeletConfiguration and checks
+// them against its type, so unknown fields or wrong types are rejected
+func parseKubeletConfig(config string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(config), &fields); err != nil {
+		return nil, fmt.Errorf("invalid kubelet config: %w", err)
+	}
+	if apiVersion, ok := fields["apiVersion"]; ok && apiVersion != kubeletConfigAPIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion %v", apiVersion)
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+
+	if len(fields) == 0 {
+		return nil, errors.New("kubelet config is empty")
+	}
+	if err := validateKubeletConfig(fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func validateKubeletConfig(fields map[string]interface{}) error {
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	var kubeletConfig kubeletconfigv1beta1.KubeletConfiguration
+	if err := yaml.UnmarshalStrict(content, &kubeletConfig); err != nil {
+		return fmt.Errorf("invalid kubelet config: %w", err)
+	}
+	return nil
+}
+
+func kubeletDropInContent(fields map[string]interface{}) (string, error) {
+	config := map[string]interface{}{
+		"apiVersion": kubeletConfigAPIVersion,
+		"kind":       kubeletConfigKind,
+	}
+	for key, value := range fields {
+		config[key] = value
+	}
+
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return overrideHeader + "\n" + string(content), nil
+}
+
+// mergeKubeletConfig sets the fields in the original config file. Nested
+// objects are merged, other values are replaced
+func mergeKubeletConfig(original string, fields map[string]interface{}) (string, error) {
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(original), &config); err != nil {
+		return "", fmt.Errorf("failed to parse kubelet config: %w", err)
+	}
+	if config["kind"] != kubeletConfigKind {
+		return "", fmt.Errorf("config file is not a %s", kubeletConfigKind)
+	}
+
+	mergeMaps(config, fields)
+
+	withoutType := map[string]interface{}{}
+	for key, value := range config {
+		if key != "apiVersion" && key != "kind" {
+			withoutType[key] = value
+		}
+	}
+	if err := validateKubeletConfig(withoutType); err != nil {
+		return "", err
+	}
+
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,72 @@
+package modules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKubeletConfig(t *testing.T) {
+	fields, err := parseKubeletConfig("apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\nmaxPods: 200\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fields["kind"]; ok || len(fields) != 1 {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+
+	for _, config := range []string{
+		"maxPod: 200",
+		"maxPods: many",
+		"apiVersion: kubelet.config.k8s.io/v1alpha1\nmaxPods: 200",
+		"kind: KubeletConfiguration",
+	} {
+		if _, err := parseKubeletConfig(config); err == nil {
+			t.Errorf("expected error for %q", config)
+		}
+	}
+}
+
+func TestKubeletDropInContent(t *testing.T) {
+	content, err := kubeletDropInContent(map[string]interface{}{"maxPods": 200})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := overrideHeader + `
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 200
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestMergeKubeletConfig(t *testing.T) {
+	original := `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+evictionHard:
+  imagefs.available: 15%
+  memory.available: 100Mi
+maxPods: 110
+`
+	fields, err := parseKubeletConfig("evictionHard:\n  memory.available: 500Mi\nmaxPods: 200\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := mergeKubeletConfig(original, fields)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range []string{"  imagefs.available: 15%", "  memory.available: 500Mi", "maxPods: 200"} {
+		if !strings.Contains(content, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, content)
+		}
+	}
+
+	if _, err := mergeKubeletConfig("kind: Pod\n", fields); err == nil {
+		t.Error("expected error for a file that isn't a KubeletConfiguration")
+	}
+}
@@ -0,0 +1,213 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// +kubebuilder:object:generate=true
+// Limits defines the resource limits of the users and of systemd services
+type Limits struct {
+	// Entries written to /etc/security/limits.d and applied by pam_limits
+	// +optional
+	Entries []LimitEntry `json:"entries,omitempty"`
+	// Default limits of the systemd services, written to
+	// /etc/systemd/system.conf.d
+	// +optional
+	SystemdDefaults []SystemdDefaultLimit `json:"systemdDefaults,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority to set for these limits (default: 50)
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=50
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (l Limits) IsPresent() bool {
+	if (len(l.Entries) != 0 || len(l.SystemdDefaults) != 0) && l.State == "present" {
+		return true
+	}
+	return false
+}
+
+type LimitEntry struct {
+	// User name, @group name, wildcard (*) or uid/gid range
+	Domain string `json:"domain"`
+	// +kubebuilder:validation:Enum=soft;hard;"-"
+	Type string `json:"type"`
+	// +kubebuilder:validation:Enum=core;data;fsize;memlock;nofile;rss;stack;cpu;nproc;as;maxlogins;maxsyslogins;nonewprivs;priority;locks;sigpending;msgqueue;nice;rtprio
+	Item string `json:"item"`
+	// +kubebuilder:validation:Pattern=`^(-?[0-9]+|unlimited|infinity)$`
+	Value string `json:"value"`
+}
+
+type SystemdDefaultLimit struct {
+	// Name of the limit, without the DefaultLimit prefix
+	// +kubebuilder:validation:Enum=CPU;FSIZE;DATA;STACK;CORE;RSS;NOFILE;AS;NPROC;MEMLOCK;LOCKS;SIGPENDING;MSGQUEUE;NICE;RTPRIO;RTTIME
+	Name string `json:"name"`
+	// Value of the limit, either a single value or soft:hard (e.g. 1024:524288)
+	// +kubebuilder:validation:Pattern=`^([0-9]+[KMGTPE]?|infinity)(:([0-9]+[KMGTPE]?|infinity))?$`
+	Value string `json:"value"`
+}
+
+type LimitsConfig struct {
+	Limits
+	logger            logr.Logger
+	limitsFilePath    string
+	systemdDropInPath string
+}
+
+func NewLimitsConfig(limits Limits, logger logr.Logger, name string) LimitsConfig {
+	return LimitsConfig{
+		Limits:            limits,
+		logger:            logger,
+		limitsFilePath:    fmt.Sprintf("/host/etc/security/limits.d/%d-nco-%s.conf", *limits.Priority, name),
+		systemdDropInPath: fmt.Sprintf("/host/etc/systemd/system.conf.d/%d-nco-%s.conf", *limits.Priority, name),
+	}
+}
+
+func (l LimitsConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		l.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"limits", nil}
+	if l.State == "present" {
+		l.logger.V(1).Info("applying module")
+		if err := l.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		l.logger.V(1).Info("module applied")
+	} else if l.State == "absent" {
+		l.logger.V(1).Info("removing module")
+		if err := l.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		l.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (l LimitsConfig) applyModule() error {
+	if len(l.Entries) != 0 {
+		content, err := limitsFileContent(l.Entries)
+		if err != nil {
+			return err
+		}
+
+		isCurrent, err := checkFileContents(l.limitsFilePath, content)
+		if err != nil {
+			return fmt.Errorf("failed to check limits file: %w", err)
+		}
+		if !isCurrent {
+			if err := writeFile(l.limitsFilePath, content); err != nil {
+				return fmt.Errorf("failed to write limits file: %w", err)
+			}
+			// pam_limits reads the file on each login, nothing to reload
+			l.logger.Info("limits updated", "path", l.limitsFilePath)
+		}
+	} else if err := deleteFileIfExists(l.limitsFilePath); err != nil {
+		return fmt.Errorf("failed to delete limits file: %w", err)
+	}
+
+	if len(l.SystemdDefaults) == 0 {
+		return l.removeSystemdDefaults()
+	}
+
+	content := systemdDefaultLimitsContent(l.SystemdDefaults)
+	isCurrent, err := checkFileContents(l.systemdDropInPath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check systemd drop-in: %w", err)
+	}
+	if !isCurrent {
+		if err := writeFile(l.systemdDropInPath, content); err != nil {
+			return fmt.Errorf("failed to write systemd drop-in: %w", err)
+		}
+		if err := l.reexecAction().mark(); err != nil {
+			return err
+		}
+	}
+
+	return l.reexecSystemd()
+}
+
+func (l LimitsConfig) removeModule() error {
+	if err := deleteFileIfExists(l.limitsFilePath); err != nil {
+		return fmt.Errorf("failed to delete limits file: %w", err)
+	}
+
+	return l.removeSystemdDefaults()
+}
+
+func (l LimitsConfig) removeSystemdDefaults() error {
+	exists, err := checkFileExists(l.systemdDropInPath)
+	if err != nil {
+		return fmt.Errorf("failed to check systemd drop-in: %w", err)
+	}
+	if exists {
+		if err := deleteFileIfExists(l.systemdDropInPath); err != nil {
+			return fmt.Errorf("failed to delete systemd drop-in: %w", err)
+		}
+		if err := l.reexecAction().mark(); err != nil {
+			return err
+		}
+	}
+
+	return l.reexecSystemd()
+}
+
+// reexecAction is recorded when the drop-in changes and cleared once systemd
+// is reexecuted, so a failed reexec is retried in the next reconciliations
+func (l LimitsConfig) reexecAction() pendingAction {
+	return newPendingAction("limits", l.systemdDropInPath)
+}
+
+// reexecSystemd makes the service manager read system.conf again. Services
+// get the new default limits the next time they're started
+func (l LimitsConfig) reexecSystemd() error {
+	pending := l.reexecAction()
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	l.logger.Info("reexecuting systemd to apply the default limits")
+	if output, err := execChroot("systemctl", "daemon-reexec"); err != nil {
+		return fmt.Errorf("failed to reexecute systemd: %s", strings.TrimSpace(string(output)))
+	}
+	return pending.done()
+}
+
+func limitsFileContent(entries []LimitEntry) (string, error) {
+	lines := []string{overrideHeader}
+	for _, entry := range entries {
+		if entry.Domain == "" || strings.ContainsAny(entry.Domain, " \t\n") {
+			return "", fmt.Errorf("invalid domain %q", entry.Domain)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", entry.Domain, entry.Type, entry.Item, entry.Value))
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func systemdDefaultLimitsContent(limits []SystemdDefaultLimit) string {
+	lines := []string{overrideHeader, "[Manager]"}
+	for _, limit := range limits {
+		lines = append(lines, fmt.Sprintf("DefaultLimit%s=%s", limit.Name, limit.Value))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,41 @@
+package modules
+
+import "testing"
+
+func TestLimitsFileContent(t *testing.T) {
+	content, err := limitsFileContent([]LimitEntry{
+		{Domain: "elasticsearch", Type: "-", Item: "nofile", Value: "65535"},
+		{Domain: "@dba", Type: "hard", Item: "memlock", Value: "unlimited"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := overrideHeader + `
+elasticsearch - nofile 65535
+@dba hard memlock unlimited
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	if _, err := limitsFileContent([]LimitEntry{{Domain: "a b", Type: "-", Item: "nofile", Value: "1"}}); err == nil {
+		t.Error("expected error for a domain with spaces")
+	}
+}
+
+func TestSystemdDefaultLimitsContent(t *testing.T) {
+	content := systemdDefaultLimitsContent([]SystemdDefaultLimit{
+		{Name: "NOFILE", Value: "1024:524288"},
+		{Name: "NPROC", Value: "infinity"},
+	})
+
+	expected := overrideHeader + `
+[Manager]
+DefaultLimitNOFILE=1024:524288
+DefaultLimitNPROC=infinity
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
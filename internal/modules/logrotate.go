@@ -0,0 +1,276 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const logrotatePath = "/etc/logrotate.d"
+
+// +kubebuilder:object:generate=true
+// Logrotate defines the rotation of log files in /etc/logrotate.d
+type Logrotate struct {
+	Entries []LogrotateEntry `json:"entries,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (l Logrotate) IsPresent() bool {
+	if len(l.Entries) != 0 && l.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type LogrotateEntry struct {
+	// Name of the entry. The file is named nco-<NodeConfig>-<name>
+	Name string `json:"name"`
+	// Absolute paths of the log files, wildcards are allowed
+	// +kubebuilder:validation:MinItems=1
+	Paths []string `json:"paths"`
+	// +kubebuilder:validation:Enum=hourly;daily;weekly;monthly;yearly
+	// +optional
+	Frequency string `json:"frequency,omitempty"`
+	// Number of rotated files to keep
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	Rotate *int `json:"rotate,omitempty"`
+	// Rotate the files when they're bigger than this size, even before the
+	// frequency (e.g. 100M)
+	// +kubebuilder:validation:Pattern=`^[0-9]+[kMG]?$`
+	// +optional
+	MaxSize string `json:"maxSize,omitempty"`
+	// Delete rotated files older than these days
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	MaxAge *int `json:"maxAge,omitempty"`
+	// +optional
+	Compress bool `json:"compress,omitempty"`
+	// Compress the rotated files on the next rotation
+	// +optional
+	DelayCompress bool `json:"delayCompress,omitempty"`
+	// Don't fail if the files don't exist (default: true)
+	// +kubebuilder:default:=true
+	// +optional
+	MissingOK *bool `json:"missingOK,omitempty"`
+	// Don't rotate empty files
+	// +optional
+	NotIfEmpty bool `json:"notIfEmpty,omitempty"`
+	// Truncate the files instead of moving them, for programs that can't
+	// reopen them
+	// +optional
+	CopyTruncate bool `json:"copyTruncate,omitempty"`
+	// Mode, owner and group of the new files (e.g. "0640 root adm")
+	// +kubebuilder:validation:Pattern=`^[0-7]{3,4}( [a-z_][a-z0-9_-]*){0,2}$`
+	// +optional
+	Create string `json:"create,omitempty"`
+	// Script to run after rotating the files
+	// +optional
+	PostRotate string `json:"postRotate,omitempty"`
+	// Run the postrotate script once for all the files of the entry
+	// +optional
+	SharedScripts bool `json:"sharedScripts,omitempty"`
+}
+
+type LogrotateConfig struct {
+	Logrotate
+	logger       logr.Logger
+	resourceName string
+	// Comment line that identifies the files written by this NodeConfig
+	ownerMarker string
+}
+
+func NewLogrotateConfig(logrotate Logrotate, logger logr.Logger, name string) LogrotateConfig {
+	return LogrotateConfig{
+		Logrotate:    logrotate,
+		logger:       logger,
+		resourceName: name,
+		ownerMarker:  fmt.Sprintf("# NCO OWNER %s", name),
+	}
+}
+
+func (l LogrotateConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		l.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"logrotate", nil}
+	if l.State == "present" {
+		l.logger.V(1).Info("applying module")
+		if err := l.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		l.logger.V(1).Info("module applied")
+	} else if l.State == "absent" {
+		l.logger.V(1).Info("removing module")
+		if err := l.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		l.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (l LogrotateConfig) applyModule() error {
+	desired := map[string]bool{}
+	for _, entry := range l.Entries {
+		content, err := logrotateEntryContent(l.ownerMarker, entry)
+		if err != nil {
+			return fmt.Errorf("invalid entry %s: %w", entry.Name, err)
+		}
+
+		filePath := l.filePath(entry)
+		desired["/host"+filePath] = true
+		isCurrent, err := checkFileContents("/host"+filePath, content)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", filePath, err)
+		}
+		if isCurrent {
+			continue
+		}
+
+		if err := l.validateEntry(entry, content); err != nil {
+			return err
+		}
+		// logrotate skips files writable by the group or other users
+		if err := writeFileAtomic("/host"+filePath, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		l.logger.Info("logrotate entry updated", "path", filePath)
+	}
+
+	return l.removeOwnedFiles(desired)
+}
+
+func (l LogrotateConfig) removeModule() error {
+	for _, entry := range l.Entries {
+		if err := deleteFileIfExists("/host" + l.filePath(entry)); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", l.filePath(entry), err)
+		}
+	}
+
+	return l.removeOwnedFiles(map[string]bool{})
+}
+
+// removeOwnedFiles deletes the files of this NodeConfig that are not in the
+// desired set, like the ones of entries removed from the list
+func (l LogrotateConfig) removeOwnedFiles(desired map[string]bool) error {
+	files, err := ownedFiles("/host"+logrotatePath+"/nco-*", l.ownerMarker)
+	if err != nil {
+		return fmt.Errorf("failed to list logrotate files: %w", err)
+	}
+
+	for _, fileName := range files {
+		if desired[fileName] {
+			continue
+		}
+
+		l.logger.Info("removing logrotate entry", "path", fileName)
+		if err := deleteFileIfExists(fileName); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+// validateEntry runs logrotate in debug mode, which parses the configuration
+// without rotating the files. The temporary file is written outside of
+// /etc/logrotate.d so logrotate never runs it
+func (l LogrotateConfig) validateEntry(entry LogrotateEntry, content string) error {
+	tmpPath := fmt.Sprintf("/tmp/nco-logrotate-%s-%s", l.resourceName, sanitizeFileName(entry.Name))
+	if err := writeFileAtomic("/host"+tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	defer func() {
+		_ = deleteFileIfExists("/host" + tmpPath)
+	}()
+
+	output, err := execChroot("logrotate", "-d", tmpPath)
+	if err != nil {
+		return fmt.Errorf("validation of entry %s failed: %s", entry.Name, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func (l LogrotateConfig) filePath(entry LogrotateEntry) string {
+	return fmt.Sprintf("%s/nco-%s-%s", logrotatePath, l.resourceName, sanitizeFileName(entry.Name))
+}
+
+func logrotateEntryContent(ownerMarker string, entry LogrotateEntry) (string, error) {
+	paths := make([]string, len(entry.Paths))
+	for i, path := range entry.Paths {
+		if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "{}\"\n") {
+			return "", fmt.Errorf("invalid path %q", path)
+		}
+		if strings.ContainsAny(path, " \t") {
+			path = "\"" + path + "\""
+		}
+		paths[i] = path
+	}
+
+	lines := []string{overrideHeader, ownerMarker, strings.Join(paths, " ") + " {"}
+	add := func(directive string) {
+		lines = append(lines, "\t"+directive)
+	}
+
+	if entry.Frequency != "" {
+		add(entry.Frequency)
+	}
+	if entry.Rotate != nil {
+		add(fmt.Sprintf("rotate %d", *entry.Rotate))
+	}
+	if entry.MaxSize != "" {
+		add("maxsize " + entry.MaxSize)
+	}
+	if entry.MaxAge != nil {
+		add(fmt.Sprintf("maxage %d", *entry.MaxAge))
+	}
+	if entry.Compress {
+		add("compress")
+	}
+	if entry.DelayCompress {
+		add("delaycompress")
+	}
+	if entry.MissingOK == nil || *entry.MissingOK {
+		add("missingok")
+	}
+	if entry.NotIfEmpty {
+		add("notifempty")
+	}
+	if entry.CopyTruncate {
+		add("copytruncate")
+	}
+	if entry.Create != "" {
+		add("create " + entry.Create)
+	}
+	if entry.SharedScripts {
+		add("sharedscripts")
+	}
+	if entry.PostRotate != "" {
+		add("postrotate")
+		for _, line := range strings.Split(strings.TrimRight(entry.PostRotate, "\n"), "\n") {
+			if strings.TrimSpace(line) == "endscript" {
+				return "", errors.New("postRotate must not contain endscript")
+			}
+			add("\t" + line)
+		}
+		add("endscript")
+	}
+
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n") + "\n", nil
+}
@@ -0,0 +1,49 @@
+package modules
+
+import "testing"
+
+func TestLogrotateEntryContent(t *testing.T) {
+	rotate := 7
+	content, err := logrotateEntryContent("# NCO OWNER default-sample", LogrotateEntry{
+		Name:          "app",
+		Paths:         []string{"/var/log/app/*.log", "/var/log/my app.log"},
+		Frequency:     "daily",
+		Rotate:        &rotate,
+		Compress:      true,
+		Create:        "0640 root adm",
+		SharedScripts: true,
+		PostRotate:    "systemctl reload app\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := overrideHeader + `
+# NCO OWNER default-sample
+/var/log/app/*.log "/var/log/my app.log" {
+	daily
+	rotate 7
+	compress
+	missingok
+	create 0640 root adm
+	sharedscripts
+	postrotate
+		systemctl reload app
+	endscript
+}
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	invalid := []LogrotateEntry{
+		{Paths: []string{"var/log/app.log"}},
+		{Paths: []string{"/var/log/app.log {"}},
+		{Paths: []string{"/var/log/app.log"}, PostRotate: "endscript\nrm -rf /"},
+	}
+	for _, entry := range invalid {
+		if _, err := logrotateEntryContent("# NCO OWNER default-sample", entry); err == nil {
+			t.Errorf("expected error for %+v", entry)
+		}
+	}
+}
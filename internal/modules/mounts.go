@@ -0,0 +1,473 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	fstabPath     = "/host/etc/fstab"
+	mountInfoPath = "/host/proc/1/mountinfo"
+)
+
+const (
+	FSTAB_BACKEND   = "fstab"
+	SYSTEMD_BACKEND = "systemd"
+)
+
+// +kubebuilder:object:generate=true
+// Mounts defines the filesystems mounted in the host
+type Mounts struct {
+	Mounts []Mount `json:"mounts,omitempty"`
+	// Backend used to persist the mounts, entries in /etc/fstab or systemd
+	// mount units
+	// +kubebuilder:validation:Enum=fstab;systemd
+	// +kubebuilder:default:=fstab
+	Backend string `json:"backend,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (m Mounts) IsPresent() bool {
+	if len(m.Mounts) != 0 && m.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type Mount struct {
+	// Device, remote filesystem or pseudo filesystem to mount (e.g.
+	// /dev/nvme1n1, nfs.example.com:/export or tmpfs)
+	Source string `json:"source"`
+	// Absolute path of the mount point, it's created if it doesn't exist
+	Path string `json:"path"`
+	// Filesystem type (e.g. ext4, xfs, nfs or tmpfs)
+	FSType string `json:"fsType"`
+	// Mount options (default: defaults)
+	Options []string `json:"options,omitempty"`
+}
+
+type MountsConfig struct {
+	Mounts
+	*statusRecorder
+	logger      logr.Logger
+	beginMarker string
+	endMarker   string
+}
+
+func NewMountsConfig(mounts Mounts, logger logr.Logger, name string) MountsConfig {
+	return MountsConfig{
+		Mounts:         mounts,
+		statusRecorder: newStatusRecorder("mounts"),
+		logger:         logger,
+		beginMarker:    fmt.Sprintf("# BEGIN MARKER NCO %s", name),
+		endMarker:      fmt.Sprintf("# END MARKER NCO %s", name),
+	}
+}
+
+func (m MountsConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		m.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"mounts", nil}
+	if m.State == "present" {
+		m.logger.V(1).Info("applying module")
+		if err := m.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		m.logger.V(1).Info("module applied")
+	} else if m.State == "absent" {
+		m.logger.V(1).Info("removing module")
+		if err := m.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		m.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (m MountsConfig) applyModule() error {
+	for _, mount := range m.Mounts.Mounts {
+		if err := validateFilePath(mount.Path); err != nil {
+			return err
+		}
+		if err := checkOrCreateDirectory("/host" + mount.Path); err != nil {
+			return fmt.Errorf("failed to create mount point %s: %w", mount.Path, err)
+		}
+	}
+
+	if m.Backend == SYSTEMD_BACKEND {
+		if err := m.applyMountUnits(); err != nil {
+			return err
+		}
+	} else {
+		if err := m.applyFstab(); err != nil {
+			return err
+		}
+	}
+
+	return m.verifyMounts()
+}
+
+func (m MountsConfig) removeModule() error {
+	mountInfo, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+
+	// Unmount everything before removing the configuration, so a busy mount
+	// keeps its entry and can be removed in the next reconciliation
+	for _, mount := range m.Mounts.Mounts {
+		if _, ok := mountInfo[mount.Path]; !ok {
+			continue
+		}
+
+		m.logger.Info("unmounting", "path", mount.Path)
+		output, err := execHostNamespace("umount", mount.Path)
+		if err != nil {
+			return fmt.Errorf("failed to unmount %s, it may be busy: %s", mount.Path, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if m.Backend == SYSTEMD_BACKEND {
+		for _, mount := range m.Mounts.Mounts {
+			unitName, err := mountUnitName(mount.Path)
+			if err != nil {
+				return err
+			}
+
+			_, err = execChroot("systemctl", "disable", unitName)
+			if err != nil {
+				m.logger.V(1).Info("failed to disable unit", "unit", unitName)
+			}
+
+			if err := deleteFileIfExists(systemdPath + "/" + unitName); err != nil {
+				return fmt.Errorf("failed to delete mount unit: %w", err)
+			}
+		}
+
+		if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+		return nil
+	}
+
+	if err := deleteBlockFromFile(fstabPath, []byte(m.beginMarker), []byte(m.endMarker)); err != nil {
+		return fmt.Errorf("failed to remove fstab entries: %w", err)
+	}
+
+	// Unload the mount units generated from the removed entries
+	if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload daemon: %w", err)
+	}
+	return nil
+}
+
+// applyFstab writes the mounts to a block in /etc/fstab and mounts the ones
+// that aren't mounted yet
+func (m MountsConfig) applyFstab() error {
+	lines := make([]string, len(m.Mounts.Mounts))
+	for i, mount := range m.Mounts.Mounts {
+		lines[i] = fmt.Sprintf("%s %s %s %s 0 0",
+			escapeFstabField(mount.Source), escapeFstabField(mount.Path),
+			mount.FSType, mountOptions(mount))
+	}
+
+	block := strings.Join(lines, "\n")
+	isCurrent, err := checkFileContains(fstabPath, strings.Join([]string{m.beginMarker, block, m.endMarker}, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to check fstab: %w", err)
+	}
+
+	if !isCurrent {
+		err := writeBlockToFile(fstabPath, []byte(m.beginMarker), []byte(m.endMarker), []byte(block))
+		if err != nil {
+			return fmt.Errorf("failed to write fstab entries: %w", err)
+		}
+
+		// systemd generates mount units from fstab
+		if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+	}
+
+	mountInfo, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+
+	for _, mount := range m.Mounts.Mounts {
+		if _, ok := mountInfo[mount.Path]; ok {
+			continue
+		}
+
+		m.logger.Info("mounting", "path", mount.Path)
+		output, err := execHostNamespace("mount", mount.Path)
+		if err != nil {
+			return fmt.Errorf("failed to mount %s: %s", mount.Path, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// applyMountUnits writes a systemd mount unit for each mount and starts it
+func (m MountsConfig) applyMountUnits() error {
+	changed := false
+	units := make([]string, len(m.Mounts.Mounts))
+	for i, mount := range m.Mounts.Mounts {
+		unitName, err := mountUnitName(mount.Path)
+		if err != nil {
+			return err
+		}
+		units[i] = unitName
+
+		content := mountUnitContent(mount)
+		unitPath := systemdPath + "/" + unitName
+		isCurrent, err := checkFileContents(unitPath, content)
+		if err != nil {
+			return fmt.Errorf("failed to check file contents: %w", err)
+		}
+		if isCurrent {
+			continue
+		}
+
+		if err := writeFile(unitPath, content); err != nil {
+			return fmt.Errorf("failed to write mount unit: %w", err)
+		}
+		changed = true
+	}
+
+	if changed {
+		if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+	}
+
+	mountInfo, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+
+	for i, mount := range m.Mounts.Mounts {
+		unitName := units[i]
+		if output, err := execChroot("systemctl", "enable", unitName); err != nil {
+			return fmt.Errorf("failed to enable %s: %s", unitName, strings.TrimSpace(string(output)))
+		}
+
+		if _, ok := mountInfo[mount.Path]; ok {
+			continue
+		}
+
+		m.logger.Info("starting mount unit", "unit", unitName)
+		if output, err := execChroot("systemctl", "start", unitName); err != nil {
+			return fmt.Errorf("failed to start %s: %s", unitName, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// verifyMounts checks that every mount is present in the host's mountinfo
+// with the desired source and filesystem type
+func (m MountsConfig) verifyMounts() error {
+	mountInfo, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+
+	notMounted := []string{}
+	for _, mount := range m.Mounts.Mounts {
+		entry, ok := mountInfo[mount.Path]
+		if !ok {
+			m.record(mount.Path, "not mounted")
+			notMounted = append(notMounted, mount.Path)
+			continue
+		}
+
+		sourceMatches := mount.FSType == "tmpfs" || mountSourceMatches(mount.Source, entry.source, resolveMountSource)
+		if entry.fsType != mount.FSType || !sourceMatches {
+			// The mount point is used by another filesystem, it needs to be
+			// unmounted by hand as it may be in use
+			m.record(mount.Path, fmt.Sprintf("mounted with source %s and type %s, remount required",
+				entry.source, entry.fsType))
+		}
+	}
+
+	if len(notMounted) != 0 {
+		return fmt.Errorf("paths not mounted: %s", strings.Join(notMounted, ", "))
+	}
+	return nil
+}
+
+// mountSourceMatches compares the source of a mount with the device in the
+// mountinfo. Tags like UUID= and symlinks like /dev/disk/by-uuid are resolved
+// first, as the kernel only shows the device
+func mountSourceMatches(source, mounted string, resolve func(string) string) bool {
+	if source == mounted {
+		return true
+	}
+	if !isMountTag(source) && !strings.HasPrefix(source, "/dev/") {
+		return false
+	}
+	return resolve(source) == resolve(mounted)
+}
+
+var mountTags = []string{"UUID=", "LABEL=", "PARTUUID=", "PARTLABEL="}
+
+func isMountTag(source string) bool {
+	for _, tag := range mountTags {
+		if strings.HasPrefix(source, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMountSource returns the canonical path of the device of a tag or a
+// path in /dev, or the source itself if it can't be resolved
+func resolveMountSource(source string) string {
+	device := source
+	if isMountTag(source) {
+		output, err := execHostNamespace("blkid", "-l", "-o", "device", "-t", source)
+		if err != nil {
+			return source
+		}
+		device = strings.TrimSpace(string(output))
+	}
+	if !strings.HasPrefix(device, "/dev/") {
+		return device
+	}
+
+	output, err := execHostNamespace("readlink", "-f", device)
+	if err != nil {
+		return device
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func mountOptions(mount Mount) string {
+	if len(mount.Options) == 0 {
+		return "defaults"
+	}
+	return strings.Join(mount.Options, ",")
+}
+
+func mountUnitContent(mount Mount) string {
+	wantedBy := "local-fs.target"
+	if isNetworkFilesystem(mount.FSType) {
+		wantedBy = "remote-fs.target"
+	}
+
+	return fmt.Sprintf(`%s
+[Unit]
+Description=Mount %s
+
+[Mount]
+What=%s
+Where=%s
+Type=%s
+Options=%s
+
+[Install]
+WantedBy=%s
+`, overrideHeader, mount.Path, mount.Source, mount.Path, mount.FSType, mountOptions(mount), wantedBy)
+}
+
+func isNetworkFilesystem(fsType string) bool {
+	switch fsType {
+	case "nfs", "nfs4", "cifs", "smb3", "glusterfs", "ceph", "fuse.sshfs":
+		return true
+	}
+	return false
+}
+
+// mountUnitName returns the name of the systemd mount unit for path, which
+// must be the escaped path
+func mountUnitName(path string) (string, error) {
+	output, err := execChroot("systemd-escape", "--path", "--suffix=mount", path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get unit name for %s: %s", path, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// escapeFstabField escapes the spaces and tabs of a fstab field
+func escapeFstabField(field string) string {
+	field = strings.ReplaceAll(field, " ", `\040`)
+	return strings.ReplaceAll(field, "\t", `\011`)
+}
+
+type mountInfoEntry struct {
+	source string
+	fsType string
+}
+
+func readMountInfo() (map[string]mountInfoEntry, error) {
+	content, err := os.ReadFile(mountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+
+	return parseMountInfo(string(content)), nil
+}
+
+// parseMountInfo returns the entries of a /proc/<pid>/mountinfo file indexed
+// by mount point. When a path is mounted multiple times the last mount wins
+func parseMountInfo(content string) map[string]mountInfoEntry {
+	entries := map[string]mountInfoEntry{}
+	for _, line := range strings.Split(content, "\n") {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(line)
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 5 || len(fields) < separator+3 {
+			continue
+		}
+
+		mountPoint := filepath.Clean(unescapeMountInfo(fields[4]))
+		entries[mountPoint] = mountInfoEntry{
+			source: unescapeMountInfo(fields[separator+2]),
+			fsType: fields[separator+1],
+		}
+	}
+
+	return entries
+}
+
+// unescapeMountInfo replaces the octal escapes (e.g. \040 for spaces) used by
+// the kernel in mountinfo
+func unescapeMountInfo(field string) string {
+	var sb strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if value, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(field[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,69 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountInfo := `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+35 22 0:32 / /mnt/scratch\040data rw,relatime shared:15 - xfs /dev/nvme1n1 rw,attr2
+36 22 0:33 / /mnt/nfs rw,relatime shared:16 master:2 - nfs4 nfs.example.com:/export rw,vers=4.2
+37 22 0:34 / /run/tmp rw,nosuid - tmpfs tmpfs rw,size=1024k`
+
+	expected := map[string]mountInfoEntry{
+		"/":                 {source: "/dev/nvme0n1p2", fsType: "ext4"},
+		"/mnt/scratch data": {source: "/dev/nvme1n1", fsType: "xfs"},
+		"/mnt/nfs":          {source: "nfs.example.com:/export", fsType: "nfs4"},
+		"/run/tmp":          {source: "tmpfs", fsType: "tmpfs"},
+	}
+
+	actual := parseMountInfo(mountInfo)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, actual)
+	}
+}
+
+func TestEscapeFstabField(t *testing.T) {
+	if actual := escapeFstabField("/mnt/scratch data"); actual != `/mnt/scratch\040data` {
+		t.Errorf("unexpected escaped field: %s", actual)
+	}
+}
+
+func TestMountSourceMatches(t *testing.T) {
+	devices := map[string]string{
+		"UUID=1234":                 "/dev/sdb1",
+		"LABEL=data":                "/dev/dm-0",
+		"/dev/mapper/vg-data":       "/dev/dm-0",
+		"/dev/disk/by-uuid/1234":    "/dev/sdb1",
+		"/dev/sdb1":                 "/dev/sdb1",
+		"/dev/sdc1":                 "/dev/sdc1",
+		"server:/export":            "server:/export",
+		"UUID=not-found":            "UUID=not-found",
+		"PARTUUID=abcd-01":          "/dev/sdc1",
+		"192.168.1.10:/srv/nfs/dir": "192.168.1.10:/srv/nfs/dir",
+	}
+	resolve := func(source string) string {
+		return devices[source]
+	}
+
+	tests := []struct {
+		source   string
+		mounted  string
+		expected bool
+	}{
+		{"UUID=1234", "/dev/sdb1", true},
+		{"LABEL=data", "/dev/mapper/vg-data", true},
+		{"/dev/disk/by-uuid/1234", "/dev/sdb1", true},
+		{"PARTUUID=abcd-01", "/dev/sdb1", false},
+		{"UUID=not-found", "/dev/sdb1", false},
+		{"server:/export", "server:/export", true},
+		{"server:/export", "192.168.1.10:/srv/nfs/dir", false},
+	}
+
+	for _, test := range tests {
+		if matches := mountSourceMatches(test.source, test.mounted, resolve); matches != test.expected {
+			t.Errorf("mountSourceMatches(%q, %q) = %t, expected %t", test.source, test.mounted, matches, test.expected)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	netplanPath      = "/etc/netplan"
+	netplanStatePath = "/etc/nco"
+)
+
+// +kubebuilder:object:generate=true
+// Netplan defines the netplan files to install in /etc/netplan
+type Netplan struct {
+	Files []NetplanFile `json:"files,omitempty"`
+	// Seconds to wait for the API server after applying the configuration.
+	// If it's not reachable, the previous files are restored (default: 60)
+	// +kubebuilder:validation:Minimum:=10
+	// +kubebuilder:default:=60
+	// +optional
+	RevertTimeout *int `json:"revertTimeout,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority to set for these files (default: 50)
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=50
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (n Netplan) IsPresent() bool {
+	if len(n.Files) != 0 && n.State == "present" {
+		return true
+	}
+	return false
+}
+
+type NetplanFile struct {
+	// Name of the file. The file is named <priority>-nco-<NodeConfig>-<name>.yaml
+	Name string `json:"name"`
+	// Netplan configuration in YAML
+	Content string `json:"content"`
+}
+
+type NetplanConfig struct {
+	Netplan
+	*statusRecorder
+	logger       logr.Logger
+	resourceName string
+	// Directory in the host with the backup of the previous files, the
+	// script that restores them and the hash of the rejected configuration
+	stateDir string
+	// Transient systemd timer that runs the revert script if the operator
+	// doesn't confirm the configuration in time
+	revertUnit string
+}
+
+func NewNetplanConfig(netplan Netplan, logger logr.Logger, name string) NetplanConfig {
+	return NetplanConfig{
+		Netplan:        netplan,
+		statusRecorder: newStatusRecorder("netplan"),
+		logger:         logger,
+		resourceName:   name,
+		stateDir:       fmt.Sprintf("%s/netplan-%s", netplanStatePath, name),
+		revertUnit:     fmt.Sprintf("nco-netplan-revert-%s", sanitizeFileName(name)),
+	}
+}
+
+func (n NetplanConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		n.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"netplan", nil}
+	if n.State == "present" {
+		n.logger.V(1).Info("applying module")
+		if err := n.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		n.logger.V(1).Info("module applied")
+	} else if n.State == "absent" {
+		n.logger.V(1).Info("removing module")
+		if err := n.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		n.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (n NetplanConfig) applyModule() error {
+	desired := map[string]string{}
+	for _, file := range n.Files {
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal([]byte(file.Content), &parsed); err != nil {
+			return fmt.Errorf("invalid YAML in %s: %w", file.Name, err)
+		}
+		desired[n.filePath(file)] = strings.TrimRight(file.Content, "\n") + "\n"
+	}
+
+	return n.applyFiles(desired)
+}
+
+func (n NetplanConfig) removeModule() error {
+	desired := map[string]string{}
+	for _, file := range n.Files {
+		// an empty content means the file must be deleted
+		desired[n.filePath(file)] = ""
+	}
+
+	if err := n.applyFiles(desired); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll("/host" + n.stateDir); err != nil {
+		return fmt.Errorf("failed to delete netplan state: %w", err)
+	}
+	return nil
+}
+
+// applyFiles writes or deletes the files, validates them with netplan
+// generate and applies them. The previous files are restored if the
+// validation or netplan apply fail, or the API server isn't reachable after
+// applying. A systemd timer also restores them if the operator dies before
+// confirming the configuration, and the hash of a configuration that was
+// reverted is kept so it isn't applied again until it changes
+func (n NetplanConfig) applyFiles(desired map[string]string) error {
+	if err := n.confirmPendingRevert(); err != nil {
+		return err
+	}
+
+	backup, err := changedNetplanFiles("/host", desired)
+	if err != nil {
+		return err
+	}
+	if len(backup) == 0 {
+		return nil
+	}
+
+	hash := netplanConfigHash(desired)
+	rejectedPath := "/host" + n.stateDir + "/rejected"
+	rejected, err := isNetplanRejected(rejectedPath, hash)
+	if err != nil {
+		return err
+	}
+	if rejected {
+		n.recordWarning("", "netplan configuration was reverted before, it won't be applied until it changes")
+		return errors.New("netplan configuration was reverted before, waiting for a change in the NodeConfig")
+	}
+
+	if err := n.scheduleRevert(backup, hash); err != nil {
+		return err
+	}
+
+	if err := writeNetplanFiles("/host", desired); err != nil {
+		return n.revert(backup, hash, false, err)
+	}
+
+	output, err := execHostNamespace("netplan", "generate")
+	if err != nil {
+		return n.revert(backup, hash, false,
+			fmt.Errorf("netplan validation failed: %s", strings.TrimSpace(string(output))))
+	}
+
+	n.logger.Info("applying netplan configuration")
+	if output, err := execHostNamespace("netplan", "apply"); err != nil {
+		return n.revert(backup, hash, true,
+			fmt.Errorf("netplan apply failed: %s", strings.TrimSpace(string(output))))
+	}
+
+	if err := n.waitForAPIServer(); err != nil {
+		return n.revert(backup, hash, true,
+			fmt.Errorf("API server not reachable after applying netplan configuration: %w", err))
+	}
+
+	if err := n.cancelRevert(); err != nil {
+		return err
+	}
+	if err := deleteFileIfExists(rejectedPath); err != nil {
+		return fmt.Errorf("failed to delete rejected configuration hash: %w", err)
+	}
+
+	n.record("", "netplan configuration applied")
+	return nil
+}
+
+// scheduleRevert keeps the previous files and a script that restores them in
+// the host, and starts a timer that runs the script after twice the revert
+// timeout, unless the configuration is confirmed before
+func (n NetplanConfig) scheduleRevert(backup map[string]string, hash string) error {
+	backupDir := n.stateDir + "/backup"
+	if err := os.RemoveAll("/host" + backupDir); err != nil {
+		return fmt.Errorf("failed to delete previous netplan backup: %w", err)
+	}
+	for path, content := range backup {
+		if content == "" {
+			continue
+		}
+		if err := writeFileAtomic("/host"+backupDir+"/"+filepath.Base(path), content, 0600); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	script := netplanRevertScript(backup, backupDir, n.stateDir+"/rejected", hash)
+	if err := writeFile("/host"+n.stateDir+"/revert.sh", script); err != nil {
+		return fmt.Errorf("failed to write revert script: %w", err)
+	}
+
+	delay := fmt.Sprintf("--on-active=%ds", 2*n.revertTimeout())
+	output, err := execChroot("systemd-run", "--collect", "--unit="+n.revertUnit, delay, "/bin/sh", n.stateDir+"/revert.sh")
+	if err != nil {
+		return fmt.Errorf("failed to schedule netplan revert: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// revert restores the previous files, applies them if the new configuration
+// was applied, and records the configuration as rejected
+func (n NetplanConfig) revert(backup map[string]string, hash string, applied bool, cause error) error {
+	n.logger.Error(cause, "reverting netplan configuration")
+	if err := writeNetplanFiles("/host", backup); err != nil {
+		return fmt.Errorf("%w, failed to restore netplan files: %w", cause, err)
+	}
+	if applied {
+		if output, err := execHostNamespace("netplan", "apply"); err != nil {
+			return fmt.Errorf("%w, failed to apply reverted configuration: %s", cause, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if err := markNetplanRejected("/host"+n.stateDir+"/rejected", hash); err != nil {
+		return fmt.Errorf("%w, %w", cause, err)
+	}
+	if err := n.cancelRevert(); err != nil {
+		return fmt.Errorf("%w, %w", cause, err)
+	}
+
+	n.recordWarning("", "netplan configuration reverted: "+cause.Error())
+	return fmt.Errorf("%w, changes were reverted", cause)
+}
+
+// confirmPendingRevert cancels the revert timer left by an operator that died
+// while applying the configuration, if the API server is reachable. Otherwise
+// the timer is kept so it restores the previous files
+func (n NetplanConfig) confirmPendingRevert() error {
+	if _, err := execChroot("systemctl", "is-active", "--quiet", n.revertUnit+".timer"); err != nil {
+		return nil
+	}
+
+	n.logger.Info("found pending netplan revert, checking the API server")
+	if err := n.waitForAPIServer(); err != nil {
+		return fmt.Errorf("netplan configuration pending confirmation: %w", err)
+	}
+	return n.cancelRevert()
+}
+
+// cancelRevert stops the revert timer and deletes the backup
+func (n NetplanConfig) cancelRevert() error {
+	if _, err := execChroot("systemctl", "is-active", "--quiet", n.revertUnit+".timer"); err == nil {
+		if output, err := execChroot("systemctl", "stop", n.revertUnit+".timer"); err != nil {
+			return fmt.Errorf("failed to cancel netplan revert: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	if err := os.RemoveAll("/host" + n.stateDir + "/backup"); err != nil {
+		return fmt.Errorf("failed to delete netplan backup: %w", err)
+	}
+	if err := deleteFileIfExists("/host" + n.stateDir + "/revert.sh"); err != nil {
+		return fmt.Errorf("failed to delete revert script: %w", err)
+	}
+	return nil
+}
+
+func (n NetplanConfig) revertTimeout() int {
+	if n.RevertTimeout != nil {
+		return *n.RevertTimeout
+	}
+	return 60
+}
+
+// waitForAPIServer checks if a TCP connection to the API server can be
+// opened until the revert timeout expires
+func (n NetplanConfig) waitForAPIServer() error {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return errors.New("API server address not found")
+	}
+	address := net.JoinHostPort(host, port)
+
+	deadline := time.Now().Add(time.Duration(n.revertTimeout()) * time.Second)
+
+	var err error
+	for time.Now().Before(deadline) {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", address, 5*time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	return fmt.Errorf("failed to connect to %s: %w", address, err)
+}
+
+func (n NetplanConfig) filePath(file NetplanFile) string {
+	return fmt.Sprintf("%s/%d-nco-%s-%s.yaml", netplanPath, *n.Priority, n.resourceName, sanitizeFileName(file.Name))
+}
+
+// changedNetplanFiles returns the previous content of the files that differ
+// from the desired content, empty for the files that don't exist
+func changedNetplanFiles(root string, desired map[string]string) (map[string]string, error) {
+	backup := map[string]string{}
+	for path, content := range desired {
+		previous, err := os.ReadFile(root + path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if string(previous) != content {
+			backup[path] = string(previous)
+		}
+	}
+
+	return backup, nil
+}
+
+// writeNetplanFiles writes the files, deleting the ones with an empty
+// content. netplan warns about files readable by other users, as they can
+// contain secrets
+func writeNetplanFiles(root string, files map[string]string) error {
+	for path, content := range files {
+		if content == "" {
+			if err := deleteFileIfExists(root + path); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", path, err)
+			}
+			continue
+		}
+
+		if err := writeFileAtomic(root+path, content, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// netplanConfigHash returns a hash of the desired files that doesn't depend
+// on the order of the map
+func netplanConfigHash(desired map[string]string) string {
+	paths := sortedKeys(desired)
+	lines := []string{}
+	for _, path := range paths {
+		lines = append(lines, path, contentSHA256(desired[path]))
+	}
+	return contentSHA256(strings.Join(lines, "\n"))
+}
+
+func isNetplanRejected(path, hash string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read rejected configuration hash: %w", err)
+	}
+	return strings.TrimSpace(string(content)) == hash, nil
+}
+
+func markNetplanRejected(path, hash string) error {
+	if err := writeFile(path, hash+"\n"); err != nil {
+		return fmt.Errorf("failed to record rejected configuration: %w", err)
+	}
+	return nil
+}
+
+// netplanRevertScript returns the script run by the revert timer. It restores
+// the files from the backup directory, records the configuration as rejected
+// and applies the previous configuration
+func netplanRevertScript(backup map[string]string, backupDir, rejectedPath, hash string) string {
+	lines := []string{"#!/bin/sh", overrideHeader}
+	for _, path := range sortedKeys(backup) {
+		if backup[path] == "" {
+			lines = append(lines, "rm -f "+path)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("install -m 0600 %s/%s %s", backupDir, filepath.Base(path), path))
+	}
+	lines = append(lines,
+		fmt.Sprintf("echo %s > %s", hash, rejectedPath),
+		"netplan apply",
+	)
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,118 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedNetplanFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, netplanPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"50-nco-test-bond.yaml":    "network: {version: 2}\n",
+		"50-nco-test-vlans.yaml":   "network: {vlans: {}}\n",
+		"50-nco-test-old.yaml":     "network: {ethernets: {}}\n",
+		"01-netcfg-unmanaged.yaml": "network: {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	desired := map[string]string{
+		netplanPath + "/50-nco-test-bond.yaml":  "network: {version: 2}\n",
+		netplanPath + "/50-nco-test-vlans.yaml": "network: {vlans: {vlan10: {}}}\n",
+		netplanPath + "/50-nco-test-new.yaml":   "network: {bridges: {}}\n",
+		netplanPath + "/50-nco-test-old.yaml":   "",
+	}
+	backup, err := changedNetplanFiles(root, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		netplanPath + "/50-nco-test-vlans.yaml": "network: {vlans: {}}\n",
+		netplanPath + "/50-nco-test-new.yaml":   "",
+		netplanPath + "/50-nco-test-old.yaml":   "network: {ethernets: {}}\n",
+	}
+	if !reflect.DeepEqual(backup, expected) {
+		t.Fatalf("unexpected backup: %v", backup)
+	}
+
+	if err := writeNetplanFiles(root, desired); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := changedNetplanFiles(root, desired); err != nil || len(changed) != 0 {
+		t.Fatalf("expected desired files to be written, got %v, %v", changed, err)
+	}
+
+	// Restoring the backup leaves the directory as it was
+	if err := writeNetplanFiles(root, backup); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("expected %d files after restoring, got %d", len(files), len(entries))
+	}
+	for name, content := range files {
+		current, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(current) != content {
+			t.Errorf("unexpected content of %s after restoring: %q", name, current)
+		}
+	}
+}
+
+func TestNetplanRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netplan-test", "rejected")
+	desired := map[string]string{
+		netplanPath + "/50-nco-test-a.yaml": "network: {version: 2}\n",
+		netplanPath + "/50-nco-test-b.yaml": "network: {vlans: {}}\n",
+	}
+	hash := netplanConfigHash(desired)
+
+	if rejected, err := isNetplanRejected(path, hash); err != nil || rejected {
+		t.Fatalf("expected no rejected configuration, got %t, %v", rejected, err)
+	}
+	if err := markNetplanRejected(path, hash); err != nil {
+		t.Fatal(err)
+	}
+	if rejected, err := isNetplanRejected(path, hash); err != nil || !rejected {
+		t.Fatalf("expected configuration to be rejected, got %t, %v", rejected, err)
+	}
+
+	// Any change in the files is a new configuration
+	desired[netplanPath+"/50-nco-test-b.yaml"] = "network: {vlans: {vlan10: {}}}\n"
+	if rejected, _ := isNetplanRejected(path, netplanConfigHash(desired)); rejected {
+		t.Error("expected changed configuration not to be rejected")
+	}
+}
+
+func TestNetplanRevertScript(t *testing.T) {
+	backup := map[string]string{
+		netplanPath + "/50-nco-test-vlans.yaml": "network: {vlans: {}}\n",
+		netplanPath + "/50-nco-test-new.yaml":   "",
+	}
+	script := netplanRevertScript(backup, "/etc/nco/netplan-test/backup", "/etc/nco/netplan-test/rejected", "abc123")
+
+	expected := "#!/bin/sh\n" + overrideHeader + `
+rm -f /etc/netplan/50-nco-test-new.yaml
+install -m 0600 /etc/nco/netplan-test/backup/50-nco-test-vlans.yaml /etc/netplan/50-nco-test-vlans.yaml
+echo abc123 > /etc/nco/netplan-test/rejected
+netplan apply
+`
+	if script != expected {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+}
@@ -0,0 +1,464 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const nftablesDropInPath = "/etc/nftables.d"
+
+// +kubebuilder:object:generate=true
+// Nftables defines a table owned by the operator. Tables created by other
+// components, like kube-proxy or CNI plugins, are never modified
+type Nftables struct {
+	// Family of the table
+	// +kubebuilder:validation:Enum=inet;ip;ip6;arp;bridge;netdev
+	// +kubebuilder:default:=inet
+	Family string `json:"family,omitempty"`
+	// Named sets of the table
+	// +optional
+	Sets []NftablesSet `json:"sets,omitempty"`
+	// Chains of the table
+	// +optional
+	Chains []NftablesChain `json:"chains,omitempty"`
+	// Statements in nft syntax added to the table after the sets and chains
+	// +optional
+	Raw string `json:"raw,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (n Nftables) IsPresent() bool {
+	isEmpty := len(n.Sets) == 0 && len(n.Chains) == 0 && n.Raw == ""
+	if !isEmpty && n.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type NftablesSet struct {
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	Name string `json:"name"`
+	// Type of the elements (e.g. ipv4_addr, inet_service)
+	Type string `json:"type"`
+	// Flags of the set (e.g. interval)
+	// +optional
+	Flags []string `json:"flags,omitempty"`
+	// +optional
+	Elements []string `json:"elements,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type NftablesChain struct {
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	Name string `json:"name"`
+	// Type of a base chain. Regular chains, used as jump targets, don't set
+	// it
+	// +kubebuilder:validation:Enum=filter;nat;route
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Hook of a base chain
+	// +kubebuilder:validation:Enum=ingress;prerouting;input;forward;output;postrouting
+	// +optional
+	Hook string `json:"hook,omitempty"`
+	// Priority of a base chain (default: 0)
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+	// Policy of a base chain
+	// +kubebuilder:validation:Enum=accept;drop
+	// +optional
+	Policy string `json:"policy,omitempty"`
+	// Rules of the chain in nft syntax (e.g. "tcp dport 22 ip saddr @admins accept")
+	Rules []string `json:"rules,omitempty"`
+}
+
+type NftablesConfig struct {
+	Nftables
+	*statusRecorder
+	logger      logr.Logger
+	tableName   string
+	filePath    string
+	beginMarker string
+	endMarker   string
+}
+
+func NewNftablesConfig(nftables Nftables, logger logr.Logger, name string) NftablesConfig {
+	return NftablesConfig{
+		Nftables:       nftables,
+		statusRecorder: newStatusRecorder("nftables"),
+		logger:         logger,
+		tableName:      "nco-" + name,
+		filePath:       fmt.Sprintf("%s/nco-%s.nft", nftablesDropInPath, name),
+		beginMarker:    fmt.Sprintf("# BEGIN MARKER NCO %s", name),
+		endMarker:      fmt.Sprintf("# END MARKER NCO %s", name),
+	}
+}
+
+func (n NftablesConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		n.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"nftables", nil}
+	if n.State == "present" {
+		n.logger.V(1).Info("applying module")
+		if err := n.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		n.logger.V(1).Info("module applied")
+	} else if n.State == "absent" {
+		n.logger.V(1).Info("removing module")
+		if err := n.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		n.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (n NftablesConfig) applyModule() error {
+	if err := checkNftablesFields(n.Nftables); err != nil {
+		return err
+	}
+
+	content := renderNftablesTable(n.tableName, n.Nftables)
+	if err := checkNftablesTable(content, n.family()+" "+n.tableName); err != nil {
+		return err
+	}
+	isCurrent, err := checkFileContents("/host"+n.filePath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check ruleset file: %w", err)
+	}
+
+	if !isCurrent {
+		if err := n.validateRuleset(content); err != nil {
+			return err
+		}
+		if err := writeFileAtomic("/host"+n.filePath, content, 0600); err != nil {
+			return fmt.Errorf("failed to write ruleset file: %w", err)
+		}
+	}
+
+	// The table is loaded again if the file changed or it was deleted from
+	// the kernel, e.g. by a "flush ruleset"
+	_, err = execChroot("nft", "list", "table", n.family(), n.tableName)
+	if !isCurrent || err != nil {
+		n.logger.Info("loading nftables table", "table", n.tableName)
+		if output, err := execChroot("nft", "-f", n.filePath); err != nil {
+			return fmt.Errorf("failed to load table: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	return n.persistRuleset()
+}
+
+func (n NftablesConfig) removeModule() error {
+	if _, err := execChroot("nft", "list", "table", n.family(), n.tableName); err == nil {
+		n.logger.Info("deleting nftables table", "table", n.tableName)
+		if output, err := execChroot("nft", "delete", "table", n.family(), n.tableName); err != nil {
+			return fmt.Errorf("failed to delete table: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	configPath, err := nftablesConfigPath()
+	if err != nil {
+		return err
+	}
+	exists, err := checkFileExists(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to check nftables config: %w", err)
+	}
+	if exists {
+		if err := deleteBlockFromFile(configPath, []byte(n.beginMarker), []byte(n.endMarker)); err != nil {
+			return fmt.Errorf("failed to remove include from nftables config: %w", err)
+		}
+	}
+
+	if err := deleteFileIfExists("/host" + n.filePath); err != nil {
+		return fmt.Errorf("failed to delete ruleset file: %w", err)
+	}
+
+	return nil
+}
+
+// validateRuleset checks the ruleset with nft -c, which parses it and
+// evaluates it against the kernel without applying it
+func (n NftablesConfig) validateRuleset(content string) error {
+	tmpPath := fmt.Sprintf("%s/.nco-%s.tmp", nftablesDropInPath, n.tableName)
+	if err := writeFile("/host"+tmpPath, content); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	defer func() {
+		_ = deleteFileIfExists("/host" + tmpPath)
+	}()
+
+	output, err := execChroot("nft", "-c", "-f", tmpPath)
+	if err != nil {
+		return fmt.Errorf("validation failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// persistRuleset includes the ruleset file from the nftables config, loaded
+// on boot by nftables.service
+func (n NftablesConfig) persistRuleset() error {
+	configPath, err := nftablesConfigPath()
+	if err != nil {
+		return err
+	}
+
+	include := fmt.Sprintf("include \"%s\"", n.filePath)
+	err = writeBlockToFile(configPath, []byte(n.beginMarker), []byte(n.endMarker), []byte(include))
+	if err != nil {
+		return fmt.Errorf("failed to include ruleset in nftables config: %w", err)
+	}
+
+	if _, err := execChroot("systemctl", "is-enabled", "--quiet", "nftables"); err != nil {
+		n.record(n.tableName, "nftables.service is not enabled, the table won't be loaded on boot")
+	}
+
+	return nil
+}
+
+func (n NftablesConfig) family() string {
+	if n.Family == "" {
+		return "inet"
+	}
+	return n.Family
+}
+
+// nftablesConfigPath returns the config loaded by nftables.service, which is
+// in /etc/sysconfig on RHEL based hosts
+func nftablesConfigPath() (string, error) {
+	rhelPath := "/host/etc/sysconfig/nftables.conf"
+	exists, err := checkFileExists(rhelPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to check nftables config: %w", err)
+	}
+	if exists {
+		return rhelPath, nil
+	}
+	return "/host/etc/nftables.conf", nil
+}
+
+// renderNftablesTable returns a ruleset that replaces the table atomically.
+// Declaring the table before deleting it makes the delete succeed when the
+// table doesn't exist yet
+func renderNftablesTable(tableName string, nftables Nftables) string {
+	family := nftables.Family
+	if family == "" {
+		family = "inet"
+	}
+	table := family + " " + tableName
+
+	lines := []string{
+		"#!/usr/sbin/nft -f",
+		overrideHeader,
+		"table " + table,
+		"delete table " + table,
+		"table " + table + " {",
+	}
+
+	for _, set := range nftables.Sets {
+		lines = append(lines, fmt.Sprintf("\tset %s {", set.Name))
+		lines = append(lines, fmt.Sprintf("\t\ttype %s", set.Type))
+		if len(set.Flags) != 0 {
+			lines = append(lines, fmt.Sprintf("\t\tflags %s", strings.Join(set.Flags, ", ")))
+		}
+		if len(set.Elements) != 0 {
+			lines = append(lines, fmt.Sprintf("\t\telements = { %s }", strings.Join(set.Elements, ", ")))
+		}
+		lines = append(lines, "\t}")
+	}
+
+	for _, chain := range nftables.Chains {
+		lines = append(lines, fmt.Sprintf("\tchain %s {", chain.Name))
+		if chain.Type != "" {
+			priority := 0
+			if chain.Priority != nil {
+				priority = *chain.Priority
+			}
+			lines = append(lines, fmt.Sprintf("\t\ttype %s hook %s priority %d", chain.Type, chain.Hook, priority))
+			if chain.Policy != "" {
+				lines = append(lines, fmt.Sprintf("\t\tpolicy %s", chain.Policy))
+			}
+		}
+		for _, rule := range chain.Rules {
+			lines = append(lines, "\t\t"+rule)
+		}
+		lines = append(lines, "\t}")
+	}
+
+	if nftables.Raw != "" {
+		for _, line := range strings.Split(strings.TrimRight(nftables.Raw, "\n"), "\n") {
+			lines = append(lines, "\t"+line)
+		}
+	}
+
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// checkNftablesFields checks that the fields pasted in the table can't close
+// their block or add statements. Rules can have anonymous sets and maps, so
+// their braces must be balanced, while the types, flags and elements of the
+// sets can't have braces at all
+func checkNftablesFields(nftables Nftables) error {
+	for _, set := range nftables.Sets {
+		fields := slices.Concat([]string{set.Type}, set.Flags, set.Elements)
+		for _, field := range fields {
+			if strings.ContainsAny(field, "{};#\r\n") {
+				return fmt.Errorf("set %s: invalid value %q", set.Name, field)
+			}
+		}
+	}
+
+	for _, chain := range nftables.Chains {
+		for _, rule := range chain.Rules {
+			if err := checkNftablesRule(rule); err != nil {
+				return fmt.Errorf("chain %s: %w", chain.Name, err)
+			}
+		}
+	}
+
+	return checkRawNftables(nftables.Raw)
+}
+
+// checkNftablesRule checks that a rule is a single statement with balanced
+// braces
+func checkNftablesRule(rule string) error {
+	if strings.ContainsAny(rule, "\r\n") {
+		return fmt.Errorf("rule must be a single statement: %q", rule)
+	}
+
+	statements, err := nftablesStatements(rule)
+	if err != nil {
+		return fmt.Errorf("invalid rule %q: %w", rule, err)
+	}
+	if len(statements) > 1 {
+		return fmt.Errorf("rule must be a single statement: %q", rule)
+	}
+	return nil
+}
+
+// checkRawNftables checks that the raw statements can't close the table block
+// or modify the whole ruleset, so other tables are never touched
+func checkRawNftables(raw string) error {
+	statements, err := nftablesStatements(raw)
+	if err != nil {
+		return fmt.Errorf("invalid raw statements: %w", err)
+	}
+
+	for _, statement := range statements {
+		switch strings.Fields(statement)[0] {
+		case "table", "flush", "delete", "add", "create", "include", "destroy":
+			return fmt.Errorf("raw statement not allowed: %q", statement)
+		}
+	}
+	return nil
+}
+
+// checkNftablesTable checks that the rendered ruleset only declares, deletes
+// and defines the table of the operator
+func checkNftablesTable(content, table string) error {
+	statements, err := nftablesStatements(content)
+	if err != nil {
+		return fmt.Errorf("invalid ruleset: %w", err)
+	}
+
+	expected := []string{"table " + table, "delete table " + table, "table " + table + " {}"}
+	if !slices.Equal(statements, expected) {
+		return fmt.Errorf("ruleset must only define table %s, got %q", table, statements)
+	}
+	return nil
+}
+
+// nftablesStatements returns the top level statements of the text, with the
+// content of their blocks removed, e.g. "table inet x {}". Comments are skipped
+// and quoted strings are kept as they are, so their braces, separators and
+// "#" are never taken as part of the syntax
+func nftablesStatements(text string) ([]string, error) {
+	statements := []string{}
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.Join(strings.Fields(current.String()), " "); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	depth := 0
+	inQuote, inComment := false, false
+	for _, char := range text {
+		switch {
+		case inComment:
+			if char != '\n' {
+				continue
+			}
+			inComment = false
+		case inQuote:
+			if char == '\n' {
+				return nil, errors.New("unterminated quoted string")
+			}
+			if char == '"' {
+				inQuote = false
+			}
+			if depth == 0 {
+				current.WriteRune(char)
+			}
+			continue
+		case char == '"':
+			inQuote = true
+		case char == '#':
+			inComment = true
+			continue
+		case char == '{':
+			depth++
+			if depth == 1 {
+				current.WriteRune(char)
+			}
+			continue
+		case char == '}':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("closing brace without an open block")
+			}
+			if depth == 0 {
+				current.WriteRune(char)
+			}
+			continue
+		}
+
+		if depth != 0 {
+			continue
+		}
+		if char == ';' || char == '\n' {
+			flush()
+			continue
+		}
+		current.WriteRune(char)
+	}
+
+	if inQuote {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced braces")
+	}
+	flush()
+	return statements, nil
+}
@@ -0,0 +1,129 @@
+package modules
+
+import "testing"
+
+func TestRenderNftablesTable(t *testing.T) {
+	priority := 10
+	content := renderNftablesTable("nco-default-fw", Nftables{
+		Sets: []NftablesSet{
+			{Name: "admins", Type: "ipv4_addr", Flags: []string{"interval"}, Elements: []string{"10.0.0.0/24", "10.0.1.5"}},
+		},
+		Chains: []NftablesChain{
+			{
+				Name:     "input",
+				Type:     "filter",
+				Hook:     "input",
+				Priority: &priority,
+				Policy:   "accept",
+				Rules:    []string{"tcp dport 22 ip saddr != @admins drop"},
+			},
+		},
+		Raw: "chain metrics {\n\ttcp dport 9100 accept\n}",
+	})
+
+	expected := "#!/usr/sbin/nft -f\n" + overrideHeader + `
+table inet nco-default-fw
+delete table inet nco-default-fw
+table inet nco-default-fw {
+	set admins {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/24, 10.0.1.5 }
+	}
+	chain input {
+		type filter hook input priority 10
+		policy accept
+		tcp dport 22 ip saddr != @admins drop
+	}
+	chain metrics {
+		tcp dport 9100 accept
+	}
+}
+`
+	if content != expected {
+		t.Errorf("unexpected ruleset:\n%s", content)
+	}
+}
+
+func TestCheckRawNftables(t *testing.T) {
+	valid := []string{
+		"",
+		"chain metrics {\n\ttcp dport 9100 accept # comment with }\n}",
+		"set ports { type inet_service; elements = { 22, 80 } }",
+		"set a { type ipv4_addr; comment \"}\" }",
+	}
+	for _, raw := range valid {
+		if err := checkRawNftables(raw); err != nil {
+			t.Errorf("unexpected error for %q: %v", raw, err)
+		}
+	}
+
+	invalid := []string{
+		"}\ntable ip nat {\n",
+		"flush ruleset",
+		"table ip filter { }",
+		"chain input {",
+		"delete table ip kube-proxy",
+		"set a { type ipv4_addr; comment \"#\" }\nset b { type ipv4_addr; comment \"#\" }\n}\nflush ruleset",
+		"chain metrics { counter; }; flush ruleset",
+		"set a { type ipv4_addr; comment \"} }",
+	}
+	for _, raw := range invalid {
+		if err := checkRawNftables(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestCheckNftablesFields(t *testing.T) {
+	valid := Nftables{
+		Sets: []NftablesSet{
+			{Name: "admins", Type: "ipv4_addr", Flags: []string{"interval"}, Elements: []string{"10.0.0.0/24", "10.0.1.1"}},
+		},
+		Chains: []NftablesChain{
+			{Name: "input", Rules: []string{
+				"tcp dport { 22, 80 } ip saddr @admins accept",
+				"meta l4proto vmap { tcp : jump tcp_in, udp : jump udp_in }",
+				"counter drop # comment with }",
+				"counter drop comment \"}\"",
+				"counter drop comment \"# {\"",
+			}},
+		},
+	}
+	if err := checkNftablesFields(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Nftables{
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"accept }\ntable ip nat {"}}}},
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"accept } table ip nat { chain x {"}}}},
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"tcp dport { 22, 80 accept"}}}},
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"accept; flush ruleset"}}}},
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"comment \"#\" } flush ruleset"}}}},
+		{Chains: []NftablesChain{{Name: "input", Rules: []string{"comment \"}"}}}},
+		{Sets: []NftablesSet{{Name: "admins", Type: "ipv4_addr; }"}}},
+		{Sets: []NftablesSet{{Name: "admins", Type: "ipv4_addr", Flags: []string{"interval }"}}}},
+		{Sets: []NftablesSet{{Name: "admins", Type: "ipv4_addr", Elements: []string{"10.0.0.1 } }\ntable ip x {"}}}},
+		{Sets: []NftablesSet{{Name: "admins", Type: "ipv4_addr", Elements: []string{"10.0.0.1 #"}}}},
+		{Raw: "flush ruleset"},
+	}
+	for _, nftables := range invalid {
+		if err := checkNftablesFields(nftables); err == nil {
+			t.Errorf("expected error for %+v", nftables)
+		}
+	}
+}
+
+func TestCheckNftablesTable(t *testing.T) {
+	content := renderNftablesTable("nco-default-fw", Nftables{
+		Chains: []NftablesChain{{Name: "input", Rules: []string{"counter comment \"} #\""}}},
+	})
+	if err := checkNftablesTable(content, "inet nco-default-fw"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	content = renderNftablesTable("nco-default-fw", Nftables{Raw: "}\ntable ip nat {"})
+	if err := checkNftablesTable(content, "inet nco-default-fw"); err == nil {
+		t.Error("expected error for a ruleset with another table")
+	}
+}
@@ -0,0 +1,649 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	sysNodePath      = "/sys/devices/system/node"
+	sysHugepagesPath = "/sys/kernel/mm/hugepages"
+	sysCPUPath       = "/sys/devices/system/cpu"
+	procCmdlinePath  = "/proc/cmdline"
+	procIRQPath      = "/proc/irq"
+	// Highest number of CPUs accepted in a cpuset list, the maximum supported
+	// by the kernel on x86_64
+	maxCPUs = 8192
+)
+
+// Size of the supported hugepages in kB, as used in the sysfs paths
+var hugepageSizesKB = map[string]int{
+	"2M": 2048,
+	"1G": 1048576,
+}
+
+// +kubebuilder:object:generate=true
+// PerformanceProfile defines the hugepages and the CPU isolation of the host
+type PerformanceProfile struct {
+	// Hugepages to allocate
+	// +optional
+	Hugepages []HugepagesAllocation `json:"hugepages,omitempty"`
+	// Default size of the hugepages
+	// +kubebuilder:validation:Enum="2M";"1G"
+	// +optional
+	DefaultHugepagesSize string `json:"defaultHugepagesSize,omitempty"`
+	// CPUs isolated from the scheduler, the timer ticks and the RCU callbacks,
+	// in cpuset list format (e.g. "2-15,18-31")
+	// +kubebuilder:validation:Pattern=`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`
+	// +optional
+	IsolatedCPUs string `json:"isolatedCPUs,omitempty"`
+	// CPUs that handle the IRQs, in cpuset list format
+	// +kubebuilder:validation:Pattern=`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`
+	// +optional
+	ReservedCPUs string `json:"reservedCPUs,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority for the grub config (default: 60). It must be higher than the
+	// grubKernelConfig priority, as that module overrides GRUB_CMDLINE_LINUX
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=60
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (p PerformanceProfile) IsPresent() bool {
+	isEmpty := len(p.Hugepages) == 0 && p.IsolatedCPUs == "" && p.ReservedCPUs == ""
+	if !isEmpty && p.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type HugepagesAllocation struct {
+	// Size of the pages
+	// +kubebuilder:validation:Enum="2M";"1G"
+	Size string `json:"size"`
+	// Number of pages to allocate
+	// +kubebuilder:validation:Minimum:=0
+	Count int `json:"count"`
+	// NUMA node where the pages are allocated. If not set, the kernel spreads
+	// the pages across all the nodes
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	Node *int `json:"node,omitempty"`
+}
+
+type PerformanceProfileConfig struct {
+	PerformanceProfile
+	*statusRecorder
+	logger   logr.Logger
+	fileName string
+	// State file with the arguments added with grubby
+	stateFile string
+}
+
+func NewPerformanceProfileConfig(profile PerformanceProfile, logger logr.Logger, name string) PerformanceProfileConfig {
+	folder := "/host/etc/default/grub.d"
+	fileName := fmt.Sprintf("%s/%d-nco-%s-performance.cfg", folder, *profile.Priority, name)
+
+	return PerformanceProfileConfig{
+		PerformanceProfile: profile,
+		statusRecorder:     newStatusRecorder("performanceProfile"),
+		logger:             logger,
+		fileName:           fileName,
+		stateFile:          fmt.Sprintf("%s/performance-%s.state", grubbyStatePath, name),
+	}
+}
+
+func (p PerformanceProfileConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		p.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"performanceProfile", nil}
+	if p.State == "present" {
+		p.logger.V(1).Info("applying module")
+		if err := p.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		p.logger.V(1).Info("module applied")
+	} else if p.State == "absent" {
+		p.logger.V(1).Info("removing module")
+		if err := p.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		p.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (p PerformanceProfileConfig) applyModule() error {
+	args, err := performanceKernelArgs(p.PerformanceProfile)
+	if err != nil {
+		return err
+	}
+
+	useGrubby, err := usesGrubby()
+	if err != nil {
+		return fmt.Errorf("failed to check boot loader: %w", err)
+	}
+	if useGrubby {
+		err = p.applyGrubby(args)
+	} else {
+		err = p.applyGrubConfig(args)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.checkCmdline(args); err != nil {
+		return err
+	}
+
+	if err := p.allocateHugepages(); err != nil {
+		return err
+	}
+
+	if p.ReservedCPUs != "" {
+		if err := p.setIRQAffinity(); err != nil {
+			return err
+		}
+	}
+
+	return p.verifyIsolation()
+}
+
+func (p PerformanceProfileConfig) removeModule() error {
+	removed, err := p.removeKernelArgs()
+	if err != nil {
+		return err
+	}
+
+	// Pages that are in use aren't released, the kernel frees them when
+	// they're no longer used
+	for _, pages := range p.Hugepages {
+		path, err := hugepagesCountPath(pages.Size, pages.Node)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+			p.logger.Error(err, "failed to release hugepages", "size", pages.Size)
+		}
+	}
+
+	if removed {
+		p.recordRebootRequired("", "kernel arguments removed")
+	}
+	return nil
+}
+
+// applyGrubConfig writes the kernel arguments to grub.d and runs update-grub
+// when they change
+func (p PerformanceProfileConfig) applyGrubConfig(args []string) error {
+	content := fmt.Sprintf("%s\nGRUB_CMDLINE_LINUX=\"$GRUB_CMDLINE_LINUX %s\"\n%s\n",
+		grubKernelBeginMarker, strings.Join(args, " "), grubKernelEndMarker)
+	isCurrent, err := checkFileContents(p.fileName, content)
+	if err != nil {
+		return fmt.Errorf("failed to check grub config: %w", err)
+	}
+	if isCurrent {
+		return nil
+	}
+
+	if err := writeFile(p.fileName, content); err != nil {
+		return fmt.Errorf("failed to write grub config: %w", err)
+	}
+	if output, err := execChroot("update-grub"); err != nil {
+		return fmt.Errorf("update-grub failed: %s", strings.TrimSpace(string(output)))
+	}
+	p.logger.Info("grub config updated", "args", args)
+	return nil
+}
+
+// applyGrubby updates the arguments of all the boot entries with grubby, as
+// the Boot Loader Specification entries don't use grub.d. Only the arguments
+// added by grubby are kept in the state file, so the ones already in the
+// entries aren't removed with the module
+func (p PerformanceProfileConfig) applyGrubby(args []string) error {
+	state, err := readGrubbyState(p.stateFile)
+	if err != nil {
+		return err
+	}
+	entries, err := grubbyEntries("ALL")
+	if err != nil {
+		return err
+	}
+
+	toAdd, toRemove, owned := grubbyArgsDiff(entries, state.added, args)
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		if slices.Equal(owned, state.added) {
+			return nil
+		}
+		state.added = owned
+		return writeGrubbyState(p.stateFile, state)
+	}
+
+	// The arguments are recorded before running grubby, so the ones added
+	// are removed with the module even if grubby fails midway
+	state.added = append(slices.Clone(owned), toRemove...)
+	if err := writeGrubbyState(p.stateFile, state); err != nil {
+		return err
+	}
+
+	if len(toRemove) != 0 {
+		if err := runGrubby("--update-kernel=ALL", "--remove-args="+strings.Join(toRemove, " ")); err != nil {
+			return err
+		}
+	}
+	if len(toAdd) != 0 {
+		if err := runGrubby("--update-kernel=ALL", "--args="+strings.Join(toAdd, " ")); err != nil {
+			return err
+		}
+	}
+	p.logger.Info("boot entries updated", "added", toAdd, "removed", toRemove)
+
+	state.added = owned
+	return writeGrubbyState(p.stateFile, state)
+}
+
+// removeKernelArgs removes the kernel arguments from the boot entries if they
+// were added with grubby, or from grub.d. It returns false if there was
+// nothing to remove
+func (p PerformanceProfileConfig) removeKernelArgs() (bool, error) {
+	stateExists, err := checkFileExists(p.stateFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to check state file: %w", err)
+	}
+	removed := false
+	if stateExists {
+		state, err := readGrubbyState(p.stateFile)
+		if err != nil {
+			return false, err
+		}
+		if len(state.added) != 0 {
+			if err := runGrubby("--update-kernel=ALL", "--remove-args="+strings.Join(state.added, " ")); err != nil {
+				return false, err
+			}
+			removed = true
+		}
+		if err := deleteFileIfExists(p.stateFile); err != nil {
+			return false, fmt.Errorf("failed to delete state file: %w", err)
+		}
+	}
+
+	exists, err := checkFileExists(p.fileName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check grub config: %w", err)
+	}
+	if !exists {
+		return removed, nil
+	}
+
+	if err := deleteFileIfExists(p.fileName); err != nil {
+		return false, fmt.Errorf("failed to delete grub config: %w", err)
+	}
+	if output, err := execChroot("update-grub"); err != nil {
+		return false, fmt.Errorf("update-grub failed: %s", strings.TrimSpace(string(output)))
+	}
+	return true, nil
+}
+
+// checkCmdline reports a reboot requirement if any of the arguments isn't in
+// the running kernel's command line
+func (p PerformanceProfileConfig) checkCmdline(args []string) error {
+	content, err := os.ReadFile(procCmdlinePath)
+	if err != nil {
+		return fmt.Errorf("failed to read kernel cmdline: %w", err)
+	}
+
+	current := strings.Fields(string(content))
+	missing := []string{}
+	for _, arg := range args {
+		if !slices.Contains(current, arg) {
+			missing = append(missing, arg)
+		}
+	}
+
+	if len(missing) != 0 {
+		p.recordRebootRequired("cmdline", fmt.Sprintf("kernel arguments not applied: %s", strings.Join(missing, " ")))
+	}
+	return nil
+}
+
+// allocateHugepages sets the number of pages at runtime and verifies that the
+// kernel allocated them. Pages that can't be allocated at runtime, usually
+// because of memory fragmentation, are allocated on the next boot
+func (p PerformanceProfileConfig) allocateHugepages() error {
+	for _, pages := range p.Hugepages {
+		path, err := hugepagesCountPath(pages.Size, pages.Node)
+		if err != nil {
+			return err
+		}
+
+		name := hugepagesName(pages)
+		current, err := readIntFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read hugepages of %s: %w", name, err)
+		}
+
+		if current != pages.Count {
+			p.logger.Info("allocating hugepages", "pages", name, "count", pages.Count)
+			if err := os.WriteFile(path, []byte(strconv.Itoa(pages.Count)), 0644); err != nil {
+				p.logger.Error(err, "failed to allocate hugepages at runtime", "pages", name)
+			}
+
+			current, err = readIntFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read hugepages of %s: %w", name, err)
+			}
+		}
+
+		if current != pages.Count {
+			p.recordRebootRequired(name, fmt.Sprintf("%d of %d pages allocated", current, pages.Count))
+			continue
+		}
+		p.record(name, fmt.Sprintf("%d pages allocated", current))
+	}
+
+	return nil
+}
+
+// setIRQAffinity moves the IRQs to the reserved CPUs. IRQs managed by the
+// kernel can't be moved and are skipped
+func (p PerformanceProfileConfig) setIRQAffinity() error {
+	cpus, err := parseCPUList(p.ReservedCPUs)
+	if err != nil {
+		return err
+	}
+
+	mask := formatCPUMask(cpus)
+	if err := os.WriteFile(filepath.Join(procIRQPath, "default_smp_affinity"), []byte(mask), 0644); err != nil {
+		return fmt.Errorf("failed to set default IRQ affinity: %w", err)
+	}
+
+	entries, err := os.ReadDir(procIRQPath)
+	if err != nil {
+		return fmt.Errorf("failed to list IRQs: %w", err)
+	}
+
+	skipped := 0
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(procIRQPath, entry.Name(), "smp_affinity_list")
+		current, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(current)) == formatCPUList(cpus) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(p.ReservedCPUs), 0644); err != nil {
+			skipped++
+		}
+	}
+
+	if skipped != 0 {
+		p.logger.V(1).Info("IRQs with fixed affinity were skipped", "count", skipped)
+	}
+	return nil
+}
+
+// verifyIsolation compares the isolated CPUs of the running kernel with the
+// desired ones
+func (p PerformanceProfileConfig) verifyIsolation() error {
+	if p.IsolatedCPUs == "" {
+		return nil
+	}
+
+	desired, err := parseCPUList(p.IsolatedCPUs)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{"isolated", "nohz_full"} {
+		content, err := os.ReadFile(filepath.Join(sysCPUPath, file))
+		if err != nil {
+			return fmt.Errorf("failed to read %s CPUs: %w", file, err)
+		}
+
+		value := strings.TrimSpace(string(content))
+		if value == "(null)" {
+			value = ""
+		}
+		current, err := parseCPUList(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s CPUs: %w", file, err)
+		}
+
+		if !slices.Equal(current, desired) {
+			p.recordRebootRequired(file, fmt.Sprintf("CPUs are %q, expected %q", formatCPUList(current), formatCPUList(desired)))
+		}
+	}
+
+	return nil
+}
+
+// performanceKernelArgs returns the kernel arguments for the profile
+func performanceKernelArgs(profile PerformanceProfile) ([]string, error) {
+	args := []string{}
+	if profile.DefaultHugepagesSize != "" {
+		args = append(args, "default_hugepagesz="+profile.DefaultHugepagesSize)
+	}
+
+	// The pages of each size are allocated on boot, either in total or per
+	// NUMA node with the "hugepages=<node>:<count>,..." syntax
+	sizes := []string{}
+	pagesBySize := map[string][]HugepagesAllocation{}
+	for _, pages := range profile.Hugepages {
+		if _, ok := hugepageSizesKB[pages.Size]; !ok {
+			return nil, fmt.Errorf("unsupported hugepages size %s", pages.Size)
+		}
+		if _, ok := pagesBySize[pages.Size]; !ok {
+			sizes = append(sizes, pages.Size)
+		}
+		pagesBySize[pages.Size] = append(pagesBySize[pages.Size], pages)
+	}
+
+	for _, size := range sizes {
+		allocations := pagesBySize[size]
+		counts := []string{}
+		for _, pages := range allocations {
+			if (pages.Node == nil) != (allocations[0].Node == nil) {
+				return nil, fmt.Errorf("hugepages of size %s must all set a NUMA node or none", size)
+			}
+			if pages.Node == nil {
+				if len(allocations) != 1 {
+					return nil, fmt.Errorf("hugepages of size %s are defined more than once", size)
+				}
+				counts = append(counts, strconv.Itoa(pages.Count))
+				continue
+			}
+			counts = append(counts, fmt.Sprintf("%d:%d", *pages.Node, pages.Count))
+		}
+		args = append(args, "hugepagesz="+size, "hugepages="+strings.Join(counts, ","))
+	}
+
+	if profile.IsolatedCPUs != "" {
+		isolated, err := parseCPUList(profile.IsolatedCPUs)
+		if err != nil {
+			return nil, err
+		}
+		cpus := formatCPUList(isolated)
+		args = append(args,
+			"isolcpus=managed_irq,domain,"+cpus,
+			"nohz_full="+cpus,
+			"rcu_nocbs="+cpus,
+		)
+	}
+
+	if profile.ReservedCPUs != "" {
+		reserved, err := parseCPUList(profile.ReservedCPUs)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "irqaffinity="+formatCPUList(reserved))
+	}
+
+	return args, nil
+}
+
+// grubbyArgsDiff returns the arguments missing from any of the boot entries,
+// the ones added before that are no longer desired, and the arguments owned
+// by the operator once they're applied. Only the arguments that none of the
+// entries had are owned, so the ones already in some entry are never removed
+func grubbyArgsDiff(entries []grubbyEntry, added, args []string) ([]string, []string, []string) {
+	toAdd := []string{}
+	for _, entry := range entries {
+		for _, arg := range args {
+			if !slices.Contains(entry.args, arg) && !slices.Contains(toAdd, arg) {
+				toAdd = append(toAdd, arg)
+			}
+		}
+	}
+
+	toRemove := []string{}
+	owned := []string{}
+	for _, arg := range added {
+		if !slices.Contains(args, arg) {
+			if !slices.Contains(toRemove, arg) {
+				toRemove = append(toRemove, arg)
+			}
+		} else if !slices.Contains(owned, arg) {
+			owned = append(owned, arg)
+		}
+	}
+	for _, arg := range toAdd {
+		inEntry := slices.ContainsFunc(entries, func(entry grubbyEntry) bool {
+			return slices.Contains(entry.args, arg)
+		})
+		if !inEntry && !slices.Contains(owned, arg) {
+			owned = append(owned, arg)
+		}
+	}
+
+	return toAdd, toRemove, owned
+}
+
+// hugepagesCountPath returns the sysfs file with the number of pages of the
+// size, in a NUMA node or in total
+func hugepagesCountPath(size string, node *int) (string, error) {
+	sizeKB, ok := hugepageSizesKB[size]
+	if !ok {
+		return "", fmt.Errorf("unsupported hugepages size %s", size)
+	}
+
+	dir := fmt.Sprintf("hugepages-%dkB", sizeKB)
+	if node == nil {
+		return filepath.Join(sysHugepagesPath, dir, "nr_hugepages"), nil
+	}
+	return filepath.Join(sysNodePath, fmt.Sprintf("node%d", *node), "hugepages", dir, "nr_hugepages"), nil
+}
+
+func hugepagesName(pages HugepagesAllocation) string {
+	if pages.Node == nil {
+		return "hugepages-" + pages.Size
+	}
+	return fmt.Sprintf("hugepages-%s-node%d", pages.Size, *pages.Node)
+}
+
+func readIntFile(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// parseCPUList parses a cpuset list (e.g. "0-3,8") into a sorted list of CPUs.
+// Reversed ranges and CPUs above maxCPUs are rejected
+func parseCPUList(list string) ([]int, error) {
+	cpus := []int{}
+	if list == "" {
+		return cpus, nil
+	}
+
+	seen := map[int]bool{}
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		if end >= maxCPUs {
+			return nil, fmt.Errorf("invalid CPU list %q: CPU %d is above the limit of %d CPUs", list, end, maxCPUs)
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// formatCPUList formats a sorted list of CPUs in the kernel's list format
+func formatCPUList(cpus []int) string {
+	items := []string{}
+	for i := 0; i < len(cpus); i++ {
+		start := cpus[i]
+		for i+1 < len(cpus) && cpus[i+1] == cpus[i]+1 {
+			i++
+		}
+		if cpus[i] == start {
+			items = append(items, strconv.Itoa(start))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", start, cpus[i]))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// formatCPUMask formats a list of CPUs as a hex mask split in 32 bit groups,
+// the format used by /proc/irq/default_smp_affinity
+func formatCPUMask(cpus []int) string {
+	groups := []uint32{0}
+	for _, cpu := range cpus {
+		for cpu/32 >= len(groups) {
+			groups = append(groups, 0)
+		}
+		groups[cpu/32] |= 1 << (cpu % 32)
+	}
+
+	items := []string{}
+	for i := len(groups) - 1; i >= 0; i-- {
+		if i == len(groups)-1 {
+			items = append(items, fmt.Sprintf("%x", groups[i]))
+		} else {
+			items = append(items, fmt.Sprintf("%08x", groups[i]))
+		}
+	}
+	return strings.Join(items, ",")
+}
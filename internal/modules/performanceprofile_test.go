@@ -0,0 +1,112 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("8,0-3,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpus, []int{0, 1, 2, 3, 8}) {
+		t.Errorf("unexpected CPUs: %v", cpus)
+	}
+
+	if formatted := formatCPUList(cpus); formatted != "0-3,8" {
+		t.Errorf("unexpected formatted list: %s", formatted)
+	}
+
+	for _, list := range []string{"a", "3-1", "1,", "-1", "0-8192", "0-99999999999"} {
+		if _, err := parseCPUList(list); err == nil {
+			t.Errorf("expected error for %q", list)
+		}
+	}
+}
+
+func TestFormatCPUMask(t *testing.T) {
+	tests := map[string]string{
+		"0,1":       "3",
+		"0-3,8":     "10f",
+		"0,32,33":   "3,00000001",
+		"":          "0",
+		"31":        "80000000",
+		"0-1,64":    "1,00000000,00000003",
+		"4-7,36-39": "f0,000000f0",
+	}
+
+	for list, expected := range tests {
+		cpus, err := parseCPUList(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mask := formatCPUMask(cpus); mask != expected {
+			t.Errorf("formatCPUMask(%q) = %s, expected %s", list, mask, expected)
+		}
+	}
+}
+
+func TestPerformanceKernelArgs(t *testing.T) {
+	node0, node1 := 0, 1
+	profile := PerformanceProfile{
+		DefaultHugepagesSize: "1G",
+		Hugepages: []HugepagesAllocation{
+			{Size: "1G", Count: 4, Node: &node0},
+			{Size: "2M", Count: 512},
+			{Size: "1G", Count: 8, Node: &node1},
+		},
+		IsolatedCPUs: "2-7",
+		ReservedCPUs: "0,1",
+	}
+
+	args, err := performanceKernelArgs(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"default_hugepagesz=1G",
+		"hugepagesz=1G", "hugepages=0:4,1:8",
+		"hugepagesz=2M", "hugepages=512",
+		"isolcpus=managed_irq,domain,2-7", "nohz_full=2-7", "rcu_nocbs=2-7",
+		"irqaffinity=0-1",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	profile.Hugepages = append(profile.Hugepages, HugepagesAllocation{Size: "1G", Count: 2})
+	if _, err := performanceKernelArgs(profile); err == nil {
+		t.Error("expected error when mixing pages with and without NUMA node")
+	}
+}
+
+func TestGrubbyArgsDiff(t *testing.T) {
+	entries := []grubbyEntry{
+		{kernel: "/boot/vmlinuz-1", args: []string{"ro", "hugepagesz=1G", "hugepages=8", "isolcpus=2-7"}},
+		{kernel: "/boot/vmlinuz-2", args: []string{"ro", "hugepagesz=1G", "hugepages=8", "nohz_full=2-7"}},
+	}
+
+	// hugepagesz=1G was already in the entries and isolcpus=2-7 in one of
+	// them, so they're not owned by the operator
+	toAdd, toRemove, owned := grubbyArgsDiff(entries, []string{"hugepages=8", "nohz_full=2-7", "hugepages=8"},
+		[]string{"hugepagesz=1G", "hugepages=16", "nohz_full=2-7", "isolcpus=2-7"})
+	if !reflect.DeepEqual(toAdd, []string{"hugepages=16", "nohz_full=2-7", "isolcpus=2-7"}) {
+		t.Errorf("unexpected args to add: %v", toAdd)
+	}
+	if !reflect.DeepEqual(toRemove, []string{"hugepages=8"}) {
+		t.Errorf("unexpected args to remove: %v", toRemove)
+	}
+	if !reflect.DeepEqual(owned, []string{"nohz_full=2-7", "hugepages=16"}) {
+		t.Errorf("unexpected owned args: %v", owned)
+	}
+
+	toAdd, toRemove, owned = grubbyArgsDiff(entries[1:], []string{"nohz_full=2-7"}, []string{"nohz_full=2-7"})
+	if len(toAdd) != 0 || len(toRemove) != 0 {
+		t.Errorf("expected no changes, got %v and %v", toAdd, toRemove)
+	}
+	if !reflect.DeepEqual(owned, []string{"nohz_full=2-7"}) {
+		t.Errorf("unexpected owned args: %v", owned)
+	}
+}
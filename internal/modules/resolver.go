@@ -0,0 +1,343 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	resolvedDropInPath = "/host/etc/systemd/resolved.conf.d"
+	resolvConfPath     = "/host/etc/resolv.conf"
+	resolvConfBackup   = "/host/etc/resolv.conf.nco-backup"
+)
+
+// +kubebuilder:object:generate=true
+// Resolver defines the DNS resolver configuration of the host
+type Resolver struct {
+	// Nameservers used to resolve names
+	Nameservers []string `json:"nameservers,omitempty"`
+	// Nameservers used when none of the nameservers are reachable, only used
+	// by systemd-resolved
+	FallbackNameservers []string `json:"fallbackNameservers,omitempty"`
+	// Search domains
+	SearchDomains []string `json:"searchDomains,omitempty"`
+	// DNSSEC validation mode, only used by systemd-resolved
+	// +kubebuilder:validation:Enum="true";"false";"allow-downgrade"
+	// +optional
+	DNSSEC string `json:"dnssec,omitempty"`
+	// Resolver options (e.g. ndots:2), only used by a static resolv.conf
+	Options []string `json:"options,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (r Resolver) IsPresent() bool {
+	if len(r.Nameservers) != 0 && r.State == "present" {
+		return true
+	}
+	return false
+}
+
+type ResolverConfig struct {
+	Resolver
+	*statusRecorder
+	logger     logr.Logger
+	dropInPath string
+}
+
+func NewResolverConfig(resolver Resolver, logger logr.Logger, name string) ResolverConfig {
+	return ResolverConfig{
+		Resolver:       resolver,
+		statusRecorder: newStatusRecorder("resolver"),
+		logger:         logger,
+		dropInPath:     fmt.Sprintf("%s/50-nco-%s.conf", resolvedDropInPath, name),
+	}
+}
+
+func (r ResolverConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		r.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"resolver", nil}
+	if r.State == "present" {
+		r.logger.V(1).Info("applying module")
+		if err := r.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		r.logger.V(1).Info("module applied")
+	} else if r.State == "absent" {
+		r.logger.V(1).Info("removing module")
+		if err := r.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		r.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (r ResolverConfig) applyModule() error {
+	if isResolvedActive() {
+		return r.applyResolved()
+	}
+
+	// A systemd-resolved that is restarting or failed must not be replaced by
+	// a static resolv.conf, only one that is disabled or not installed
+	state := resolvedUnitFileState()
+	if !resolvedFallbackAllowed(state) {
+		return fmt.Errorf("systemd-resolved is not active but its unit is %s, refusing to replace resolv.conf", state)
+	}
+	return r.applyResolvConf()
+}
+
+func (r ResolverConfig) removeModule() error {
+	exists, err := checkFileExists(r.dropInPath)
+	if err != nil {
+		return fmt.Errorf("failed to check resolved config: %w", err)
+	}
+	if exists {
+		if err := deleteFileIfExists(r.dropInPath); err != nil {
+			return fmt.Errorf("failed to delete resolved config: %w", err)
+		}
+		if err := r.restartAction().mark(); err != nil {
+			return err
+		}
+	}
+	if err := r.restartResolved(); err != nil {
+		return err
+	}
+
+	// Restore the resolv.conf replaced by the module, which can be a symlink
+	if _, err := os.Lstat(resolvConfBackup); err == nil {
+		if err := os.Rename(resolvConfBackup, resolvConfPath); err != nil {
+			return fmt.Errorf("failed to restore resolv.conf: %w", err)
+		}
+		r.logger.Info("resolv.conf restored")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check resolv.conf backup: %w", err)
+	}
+
+	return nil
+}
+
+// applyResolved writes a resolved.conf drop-in, restarts systemd-resolved if
+// it changed and verifies the nameservers with resolvectl
+func (r ResolverConfig) applyResolved() error {
+	if len(r.Options) != 0 {
+		r.logger.Info("options are only supported by a static resolv.conf, ignoring them")
+	}
+
+	content := resolvedDropInContent(r.Resolver)
+	isCurrent, err := checkFileContents(r.dropInPath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check resolved config: %w", err)
+	}
+
+	if !isCurrent {
+		if err := writeFile(r.dropInPath, content); err != nil {
+			return fmt.Errorf("failed to write resolved config: %w", err)
+		}
+		if err := r.restartAction().mark(); err != nil {
+			return err
+		}
+	}
+	if err := r.restartResolved(); err != nil {
+		return err
+	}
+
+	output, err := execHostNamespace("resolvectl", "status")
+	if err != nil {
+		return fmt.Errorf("failed to get resolver status: %s", strings.TrimSpace(string(output)))
+	}
+
+	missing := []string{}
+	for _, nameserver := range r.Nameservers {
+		if !containsNameserver(string(output), nameserver) {
+			missing = append(missing, nameserver)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("nameservers not configured in systemd-resolved: %s", strings.Join(missing, ", "))
+	}
+
+	r.record("systemd-resolved", fmt.Sprintf("nameservers: %s", strings.Join(r.Nameservers, " ")))
+	return nil
+}
+
+// applyResolvConf replaces /etc/resolv.conf with a static file. The original
+// file is kept as a backup so it can be restored when the module is removed
+func (r ResolverConfig) applyResolvConf() error {
+	if len(r.FallbackNameservers) != 0 || r.DNSSEC != "" {
+		r.logger.Info("fallbackNameservers and dnssec are only supported by systemd-resolved, ignoring them")
+	}
+
+	content := resolvConfContent(r.Resolver)
+	if info, err := os.Lstat(resolvConfPath); err == nil && info.Mode().IsRegular() {
+		isCurrent, err := checkFileContents(resolvConfPath, content)
+		if err != nil {
+			return fmt.Errorf("failed to check resolv.conf: %w", err)
+		}
+		if isCurrent {
+			r.record("resolv.conf", fmt.Sprintf("nameservers: %s", strings.Join(r.Nameservers, " ")))
+			return nil
+		}
+	}
+
+	if err := backupResolvConf(); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(resolvConfPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write resolv.conf: %w", err)
+	}
+
+	r.logger.Info("resolv.conf updated")
+	r.record("resolv.conf", fmt.Sprintf("nameservers: %s", strings.Join(r.Nameservers, " ")))
+	return nil
+}
+
+// restartAction is recorded when the drop-in changes and cleared once
+// systemd-resolved is restarted, so a failed restart is retried in the next
+// reconciliations
+func (r ResolverConfig) restartAction() pendingAction {
+	return newPendingAction("resolver", r.dropInPath)
+}
+
+func (r ResolverConfig) restartResolved() error {
+	pending := r.restartAction()
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	r.logger.Info("restarting systemd-resolved")
+	if output, err := execChroot("systemctl", "restart", "systemd-resolved"); err != nil {
+		return fmt.Errorf("failed to restart systemd-resolved: %s", strings.TrimSpace(string(output)))
+	}
+
+	isActive, err := checkIfServiceIsActive("systemd-resolved")
+	if err != nil {
+		return err
+	}
+	if !isActive {
+		return errors.New("service systemd-resolved is not active")
+	}
+
+	return pending.done()
+}
+
+func isResolvedActive() bool {
+	_, err := execChroot("systemctl", "is-active", "--quiet", "systemd-resolved")
+	return err == nil
+}
+
+// resolvedUnitFileState returns the state of the systemd-resolved unit as
+// shown by systemctl is-enabled, or "not-found" if it's not installed
+func resolvedUnitFileState() string {
+	output, err := execChroot("systemctl", "is-enabled", "systemd-resolved")
+	state := strings.TrimSpace(string(output))
+	if err != nil && (state == "" || strings.Contains(state, "No such file")) {
+		return "not-found"
+	}
+	return state
+}
+
+// resolvedFallbackAllowed checks if resolv.conf can be replaced with a static
+// file when systemd-resolved is in the unit file state
+func resolvedFallbackAllowed(state string) bool {
+	switch state {
+	case "disabled", "masked", "masked-runtime", "not-found":
+		return true
+	}
+	return false
+}
+
+// containsNameserver checks if the nameserver is one of the fields of the
+// resolvectl output. Servers can have the interface or the server name as a
+// suffix (e.g. 10.0.0.53%eth0#dns.example.com)
+func containsNameserver(output, nameserver string) bool {
+	for _, field := range strings.Fields(output) {
+		if field == nameserver || strings.HasPrefix(field, nameserver+"%") || strings.HasPrefix(field, nameserver+"#") {
+			return true
+		}
+	}
+	return false
+}
+
+// backupResolvConf keeps the original resolv.conf, or the symlink to it, the
+// first time it's replaced
+func backupResolvConf() error {
+	if _, err := os.Lstat(resolvConfBackup); err == nil {
+		return nil
+	}
+
+	info, err := os.Lstat(resolvConfPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check resolv.conf: %w", err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(resolvConfPath)
+		if err != nil {
+			return fmt.Errorf("failed to read resolv.conf symlink: %w", err)
+		}
+		if err := os.Symlink(target, resolvConfBackup); err != nil {
+			return fmt.Errorf("failed to back up resolv.conf: %w", err)
+		}
+		return nil
+	}
+
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return fmt.Errorf("failed to read resolv.conf: %w", err)
+	}
+	if err := os.WriteFile(resolvConfBackup, content, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up resolv.conf: %w", err)
+	}
+
+	return nil
+}
+
+func resolvedDropInContent(resolver Resolver) string {
+	lines := []string{overrideHeader, "[Resolve]"}
+	lines = append(lines, "DNS="+strings.Join(resolver.Nameservers, " "))
+	if len(resolver.FallbackNameservers) != 0 {
+		lines = append(lines, "FallbackDNS="+strings.Join(resolver.FallbackNameservers, " "))
+	}
+	if len(resolver.SearchDomains) != 0 {
+		lines = append(lines, "Domains="+strings.Join(resolver.SearchDomains, " "))
+	}
+	if resolver.DNSSEC != "" {
+		lines = append(lines, "DNSSEC="+resolver.DNSSEC)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func resolvConfContent(resolver Resolver) string {
+	lines := []string{overrideHeader}
+	for _, nameserver := range resolver.Nameservers {
+		lines = append(lines, "nameserver "+nameserver)
+	}
+	if len(resolver.SearchDomains) != 0 {
+		lines = append(lines, "search "+strings.Join(resolver.SearchDomains, " "))
+	}
+	if len(resolver.Options) != 0 {
+		lines = append(lines, "options "+strings.Join(resolver.Options, " "))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,78 @@
+package modules
+
+import "testing"
+
+func TestResolvedDropInContent(t *testing.T) {
+	content := resolvedDropInContent(Resolver{
+		Nameservers:         []string{"10.0.0.53", "10.0.1.53"},
+		FallbackNameservers: []string{"1.1.1.1"},
+		SearchDomains:       []string{"example.com"},
+		DNSSEC:              "allow-downgrade",
+	})
+
+	expected := overrideHeader + `
+[Resolve]
+DNS=10.0.0.53 10.0.1.53
+FallbackDNS=1.1.1.1
+Domains=example.com
+DNSSEC=allow-downgrade
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestResolvConfContent(t *testing.T) {
+	content := resolvConfContent(Resolver{
+		Nameservers:   []string{"10.0.0.53"},
+		SearchDomains: []string{"example.com", "svc.example.com"},
+		Options:       []string{"ndots:2", "timeout:1"},
+	})
+
+	expected := overrideHeader + `
+nameserver 10.0.0.53
+search example.com svc.example.com
+options ndots:2 timeout:1
+`
+	if content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestContainsNameserver(t *testing.T) {
+	output := `Global
+       Protocols: +LLMNR +mDNS -DNSOverTLS DNSSEC=allow-downgrade/supported
+Current DNS Server: 10.0.0.53
+       DNS Servers: 10.0.0.53 10.0.1.53%eth0 1.1.1.1#cloudflare-dns.com
+`
+
+	tests := map[string]bool{
+		"10.0.0.53": true,
+		"10.0.1.53": true,
+		"1.1.1.1":   true,
+		"10.0.0.5":  false,
+		"0.0.53":    false,
+		"1.1.1":     false,
+	}
+	for nameserver, expected := range tests {
+		if found := containsNameserver(output, nameserver); found != expected {
+			t.Errorf("containsNameserver(%q) = %t, expected %t", nameserver, found, expected)
+		}
+	}
+}
+
+func TestResolvedFallbackAllowed(t *testing.T) {
+	tests := map[string]bool{
+		"disabled":  true,
+		"masked":    true,
+		"not-found": true,
+		"enabled":   false,
+		"static":    false,
+		"alias":     false,
+	}
+	for state, expected := range tests {
+		if allowed := resolvedFallbackAllowed(state); allowed != expected {
+			t.Errorf("resolvedFallbackAllowed(%q) = %t, expected %t", state, allowed, expected)
+		}
+	}
+}
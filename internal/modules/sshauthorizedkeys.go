@@ -0,0 +1,333 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+)
+
+// +kubebuilder:object:generate=true
+// SSHAuthorizedKeys defines the keys managed in the users' authorized_keys
+type SSHAuthorizedKeys struct {
+	Users []SSHAuthorizedKeysUser `json:"users,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (s SSHAuthorizedKeys) IsPresent() bool {
+	if len(s.Users) != 0 && s.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+// SSHAuthorizedKeysUser defines the keys for a single user
+type SSHAuthorizedKeysUser struct {
+	// Name of the user that owns the ~/.ssh/authorized_keys file
+	User string `json:"user"`
+	// List of keys to add to the user's authorized_keys
+	Keys []SSHAuthorizedKey `json:"keys,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// SSHAuthorizedKey defines a public key. Either key or keyFrom must be set
+type SSHAuthorizedKey struct {
+	// Public key in authorized_keys format (e.g. "ssh-ed25519 AAAA... comment")
+	Key string `json:"key,omitempty"`
+	// Secret key that contains one or more public keys, one per line
+	// +optional
+	KeyFrom *SecretKeyRef `json:"keyFrom,omitempty"`
+	// Options prepended to the key (e.g. from="10.0.0.0/8" or command="/bin/true")
+	// +optional
+	Options []string `json:"options,omitempty"`
+}
+
+type SSHAuthorizedKeysConfig struct {
+	SSHAuthorizedKeys
+	logger       logr.Logger
+	readSecret   SecretReader
+	beginMarker  string
+	endMarker    string
+	resourceName string
+}
+
+func NewSSHAuthorizedKeysConfig(
+	keys SSHAuthorizedKeys,
+	logger logr.Logger,
+	name string,
+	readSecret SecretReader,
+) SSHAuthorizedKeysConfig {
+	// Each NodeConfig uses its own markers so blocks from different
+	// resources don't overwrite each other
+	return SSHAuthorizedKeysConfig{
+		SSHAuthorizedKeys: keys,
+		logger:            logger,
+		readSecret:        readSecret,
+		beginMarker:       fmt.Sprintf("# BEGIN MARKER NCO %s", name),
+		endMarker:         fmt.Sprintf("# END MARKER NCO %s", name),
+		resourceName:      name,
+	}
+}
+
+func (s SSHAuthorizedKeysConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		s.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"sshAuthorizedKeys", nil}
+	if s.State == "present" {
+		s.logger.V(1).Info("applying module")
+		if err := s.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module applied")
+	} else if s.State == "absent" {
+		s.logger.V(1).Info("removing module")
+		if err := s.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (s SSHAuthorizedKeysConfig) applyModule() error {
+	for _, user := range s.Users {
+		lines, err := s.buildKeyLines(user.Keys)
+		if err != nil {
+			return fmt.Errorf("failed to build keys for user %s: %w", user.User, err)
+		}
+
+		u, err := lookupHostUser(user.User)
+		if err != nil {
+			return err
+		}
+
+		sshDir := filepath.Join("/host", u.home, ".ssh")
+		file, err := openAuthorizedKeys(sshDir, u, true)
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			defer file.Close()
+
+			content, err := writeBlock(file, []byte(s.beginMarker), []byte(s.endMarker), []byte(strings.Join(lines, "\n")))
+			if err != nil {
+				return err
+			}
+			if err := replaceFileContent(file, content); err != nil {
+				return err
+			}
+
+			// sshd refuses keys from files that are writable by other users
+			if err := file.Chmod(0600); err != nil {
+				return err
+			}
+			return file.Chown(u.uid, u.gid)
+		}()
+		if err != nil {
+			return fmt.Errorf("failed to write keys for user %s: %w", user.User, err)
+		}
+	}
+
+	return nil
+}
+
+func (s SSHAuthorizedKeysConfig) removeModule() error {
+	for _, user := range s.Users {
+		u, err := lookupHostUser(user.User)
+		if err != nil {
+			s.logger.V(1).Info("user not found, nothing to remove", "user", user.User)
+			continue
+		}
+
+		sshDir := filepath.Join("/host", u.home, ".ssh")
+		file, err := openAuthorizedKeys(sshDir, u, false)
+		if err != nil {
+			return err
+		}
+		if file == nil {
+			continue
+		}
+		err = func() error {
+			defer file.Close()
+
+			content, err := deleteBlock(file, []byte(s.beginMarker), []byte(s.endMarker))
+			if err != nil {
+				return err
+			}
+			return replaceFileContent(file, content)
+		}()
+		if err != nil {
+			return fmt.Errorf("failed to remove keys for user %s: %w", user.User, err)
+		}
+	}
+
+	return nil
+}
+
+// buildKeyLines returns the authorized_keys lines for the keys, reading the
+// keys that reference a secret
+func (s SSHAuthorizedKeysConfig) buildKeyLines(keys []SSHAuthorizedKey) ([]string, error) {
+	lines := []string{}
+	for _, key := range keys {
+		content := key.Key
+		if key.KeyFrom != nil {
+			value, err := s.readSecret(*key.KeyFrom)
+			if err != nil {
+				return nil, err
+			}
+			content = value
+		}
+
+		for _, publicKey := range strings.Split(content, "\n") {
+			publicKey = strings.TrimSpace(publicKey)
+			if publicKey == "" || strings.HasPrefix(publicKey, "#") {
+				continue
+			}
+
+			line, err := formatAuthorizedKey(publicKey, key.Options)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+var sshKeyTypeRegexp = regexp.MustCompile(`^(ssh-(rsa|dss|ed25519)|ecdsa-sha2-nistp(256|384|521)|sk-(ssh-ed25519|ecdsa-sha2-nistp256)@openssh\.com) [A-Za-z0-9+/=]+( .*)?$`)
+
+// Options are a name with an optional quoted value, where quotes are escaped
+// with a backslash (e.g. command="echo \"hi\"")
+var sshKeyOptionRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*(="([^"\\\n]|\\[^\n])*")?$`)
+
+// formatAuthorizedKey validates the public key and prepends the options to it
+func formatAuthorizedKey(publicKey string, options []string) (string, error) {
+	if !sshKeyTypeRegexp.MatchString(publicKey) {
+		return "", fmt.Errorf("invalid public key: %q", publicKey)
+	}
+
+	for _, option := range options {
+		if !sshKeyOptionRegexp.MatchString(option) {
+			return "", fmt.Errorf("invalid key option: %q", option)
+		}
+	}
+
+	if len(options) == 0 {
+		return publicKey, nil
+	}
+
+	return strings.Join(options, ",") + " " + publicKey, nil
+}
+
+// openAuthorizedKeys opens the authorized_keys file in sshDir without
+// following symlinks, creating both if create is true. The directory is
+// writable by the user, so the directory and the file must be owned by them,
+// otherwise they could point to any file of the host. It returns nil if the
+// file doesn't exist and create is false
+func openAuthorizedKeys(sshDir string, u hostUser, create bool) (*os.File, error) {
+	dirCreated := false
+	if create {
+		err := os.Mkdir(sshDir, 0700)
+		if err == nil {
+			dirCreated = true
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create %s: %w", sshDir, err)
+		}
+	}
+
+	dirFd, err := syscall.Open(sshDir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", sshDir, err)
+	}
+	dir := os.NewFile(uintptr(dirFd), sshDir)
+	defer dir.Close()
+
+	if err := checkOwnedByUser(dir, u, dirCreated); err != nil {
+		return nil, err
+	}
+	if create {
+		// sshd refuses keys from directories that are writable by other users
+		if err := dir.Chmod(0700); err != nil {
+			return nil, err
+		}
+		if err := dir.Chown(u.uid, u.gid); err != nil {
+			return nil, err
+		}
+	}
+
+	filePath := filepath.Join(sshDir, "authorized_keys")
+	flags := syscall.O_RDWR | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+	fileCreated := false
+	fd, err := -1, os.ErrNotExist
+	if create {
+		fd, err = syscall.Openat(dirFd, "authorized_keys", flags|syscall.O_CREAT|syscall.O_EXCL, 0600)
+		fileCreated = err == nil
+	}
+	if !fileCreated {
+		fd, err = syscall.Openat(dirFd, "authorized_keys", flags, 0)
+	}
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	file := os.NewFile(uintptr(fd), filePath)
+
+	if err := checkOwnedByUser(file, u, fileCreated); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// checkOwnedByUser checks that the opened file is owned by the user, unless
+// the operator just created it. Files with several hard links are refused too
+func checkOwnedByUser(file *os.File, u hostUser, created bool) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("failed to get owner of %s", file.Name())
+	}
+
+	if !created && int(stat.Uid) != u.uid {
+		return fmt.Errorf("%s is not owned by %s", file.Name(), u.name)
+	}
+	if !info.IsDir() && (!info.Mode().IsRegular() || stat.Nlink != 1) {
+		return fmt.Errorf("%s is not a regular file", file.Name())
+	}
+	return nil
+}
+
+// replaceFileContent writes the content to the opened file, replacing the
+// previous one
+func replaceFileContent(file *os.File, content []byte) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt(content, 0)
+	return err
+}
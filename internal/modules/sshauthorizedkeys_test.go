@@ -0,0 +1,108 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatAuthorizedKey(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHB user@host"
+
+	line, err := formatAuthorizedKey(key, []string{`from="10.0.0.0/8"`, "no-pty", `command="echo \"hi\""`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `from="10.0.0.0/8",no-pty,command="echo \"hi\"" ` + key
+	if line != expected {
+		t.Errorf("unexpected line: %s", line)
+	}
+
+	for _, option := range []string{
+		"no-pty\nssh-rsa AAAA attacker",
+		`command="a"b`,
+		`command="a",from="b`,
+		`command="a" ssh-rsa`,
+		`from="a
+b"`,
+		`command="a\"`,
+		"",
+	} {
+		if _, err := formatAuthorizedKey(key, []string{option}); err == nil {
+			t.Errorf("expected error for option %q", option)
+		}
+	}
+}
+
+func TestOpenAuthorizedKeys(t *testing.T) {
+	u := hostUser{name: "test", uid: os.Getuid(), gid: os.Getgid()}
+	home := t.TempDir()
+	sshDir := filepath.Join(home, ".ssh")
+
+	file, err := openAuthorizedKeys(sshDir, u, false)
+	if err != nil || file != nil {
+		t.Fatalf("expected no file, got %v, %v", file, err)
+	}
+
+	file, err = openAuthorizedKeys(sshDir, u, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFileContent(file, []byte("content\n")); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	target := filepath.Join(home, "target")
+	if err := os.WriteFile(target, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A symlinked authorized_keys is refused
+	keysPath := filepath.Join(sshDir, "authorized_keys")
+	if err := os.Remove(keysPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, keysPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openAuthorizedKeys(sshDir, u, true); err == nil {
+		t.Error("expected error for a symlinked authorized_keys")
+	}
+
+	// A hard link to another file is refused
+	if err := os.Remove(keysPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(target, keysPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openAuthorizedKeys(sshDir, u, true); err == nil {
+		t.Error("expected error for a hard linked authorized_keys")
+	}
+
+	// A symlinked .ssh directory is refused
+	otherDir := filepath.Join(home, "other")
+	if err := os.Mkdir(otherDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(sshDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(otherDir, sshDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openAuthorizedKeys(sshDir, u, true); err == nil {
+		t.Error("expected error for a symlinked .ssh directory")
+	}
+
+	// Files owned by another user are refused
+	other := hostUser{name: "other", uid: u.uid + 1, gid: u.gid}
+	if _, err := openAuthorizedKeys(otherDir, other, true); err == nil {
+		t.Error("expected error for a directory owned by another user")
+	}
+
+	if content, _ := os.ReadFile(target); string(content) != "secret\n" {
+		t.Errorf("target was modified: %q", content)
+	}
+}
@@ -0,0 +1,202 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const sudoersPath = "/etc/sudoers.d"
+
+// +kubebuilder:object:generate=true
+// Sudoers defines the files to install in /etc/sudoers.d
+type Sudoers struct {
+	Files []SudoersFile `json:"files,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (s Sudoers) IsPresent() bool {
+	if len(s.Files) != 0 && s.State == "present" {
+		return true
+	}
+	return false
+}
+
+type SudoersFile struct {
+	// Name of the file. It's prefixed with "nco-" and the NodeConfig name
+	Name string `json:"name"`
+	// Contents of the sudoers file
+	Content string `json:"content"`
+}
+
+type SudoersConfig struct {
+	Sudoers
+	*statusRecorder
+	logger       logr.Logger
+	resourceName string
+	ownerMarker  string
+	// directory is the path of sudoers.d in the operator's filesystem
+	directory string
+}
+
+func NewSudoersConfig(sudoers Sudoers, logger logr.Logger, name string) SudoersConfig {
+	return SudoersConfig{
+		Sudoers:        sudoers,
+		statusRecorder: newStatusRecorder("sudoers"),
+		logger:         logger,
+		// sudo skips files in sudoers.d that contain a dot
+		resourceName: strings.ReplaceAll(name, ".", "_"),
+		ownerMarker:  fmt.Sprintf("# NCO OWNER %s", name),
+		directory:    "/host" + sudoersPath,
+	}
+}
+
+func (s SudoersConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		s.logger.Error(err, "module needs chroot to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"sudoers", nil}
+	if s.State == "present" {
+		s.logger.V(1).Info("applying module")
+		if err := s.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module applied")
+	} else if s.State == "absent" {
+		s.logger.V(1).Info("removing module")
+		if err := s.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (s SudoersConfig) applyModule() error {
+	// files whose names only differ in invalid characters would overwrite each
+	// other
+	desired := map[string]bool{}
+	for _, file := range s.Files {
+		filePath := s.filePath(file)
+		if desired[filePath] {
+			return fmt.Errorf("sudoers file %s has the same file name as another file", file.Name)
+		}
+		desired[filePath] = true
+	}
+
+	failedFiles := []string{}
+	for _, file := range s.Files {
+		if err := s.installFile(file); err != nil {
+			s.logger.Error(err, "failed to install sudoers file", "name", file.Name)
+			s.record(file.Name, err.Error())
+			failedFiles = append(failedFiles, file.Name)
+		}
+	}
+
+	if len(failedFiles) != 0 {
+		return fmt.Errorf("failed to install sudoers files: %s", strings.Join(failedFiles, ", "))
+	}
+
+	return s.removeOwnedFiles(desired)
+}
+
+func (s SudoersConfig) removeModule() error {
+	for _, file := range s.Files {
+		if err := deleteFileIfExists(s.filePath(file)); err != nil {
+			return fmt.Errorf("failed to delete sudoers file %s: %w", file.Name, err)
+		}
+	}
+
+	return s.removeOwnedFiles(map[string]bool{})
+}
+
+// removeOwnedFiles deletes the files of this NodeConfig that are not in
+// desired, e.g. files removed or renamed in the NodeConfig
+func (s SudoersConfig) removeOwnedFiles(desired map[string]bool) error {
+	files, err := ownedFiles(s.directory+"/nco-*", s.ownerMarker)
+	if err != nil {
+		return fmt.Errorf("failed to list sudoers files: %w", err)
+	}
+
+	for _, fileName := range files {
+		if desired[fileName] {
+			continue
+		}
+
+		s.logger.Info("removing sudoers file", "path", fileName)
+		if err := deleteFileIfExists(fileName); err != nil {
+			return fmt.Errorf("failed to delete sudoers file %s: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+// installFile writes the file to a temporary path, validates it with visudo
+// and renames it to its final path. A file that fails validation is never
+// installed as it could lock every user out of sudo
+func (s SudoersConfig) installFile(file SudoersFile) error {
+	filePath := s.filePath(file)
+	content := sudoersFileContent(s.ownerMarker, file)
+
+	isCurrent, err := checkFileContents(filePath, content)
+	if err != nil {
+		return fmt.Errorf("failed to check file contents: %w", err)
+	}
+	if isCurrent {
+		return os.Chmod(filePath, 0440)
+	}
+
+	// sudo ignores files that contain a dot, so the temporary file is never
+	// loaded even if it's left behind
+	tmpName := fmt.Sprintf(".%s.tmp", s.fileName(file))
+	tmpPath := s.directory + "/" + tmpName
+	if err := os.WriteFile(tmpPath, []byte(content), 0440); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	defer func() {
+		_ = deleteFileIfExists(tmpPath)
+	}()
+
+	if err := os.Chmod(tmpPath, 0440); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	output, err := execChroot("visudo", "-cf", sudoersPath+"/"+tmpName)
+	if err != nil {
+		return fmt.Errorf("validation failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to install file: %w", err)
+	}
+
+	s.logger.V(1).Info("sudoers file installed", "path", filePath)
+	return nil
+}
+
+func (s SudoersConfig) fileName(file SudoersFile) string {
+	return fmt.Sprintf("nco-%s-%s", s.resourceName, sanitizeFileName(file.Name))
+}
+
+func (s SudoersConfig) filePath(file SudoersFile) string {
+	return s.directory + "/" + s.fileName(file)
+}
+
+// sudoersFileContent returns the file with the owner marker, a comment for
+// sudo, on its first line
+func sudoersFileContent(ownerMarker string, file SudoersFile) string {
+	return ownerMarker + "\n" + strings.TrimRight(file.Content, "\n") + "\n"
+}
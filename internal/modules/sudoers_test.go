@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSudoersFileContent(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{
+			content:  "deploy ALL=(ALL) NOPASSWD: /usr/bin/systemctl",
+			expected: "# NCO OWNER default-sample\ndeploy ALL=(ALL) NOPASSWD: /usr/bin/systemctl\n",
+		},
+		{
+			content:  "Defaults:deploy !requiretty\ndeploy ALL=(ALL) ALL\n\n\n",
+			expected: "# NCO OWNER default-sample\nDefaults:deploy !requiretty\ndeploy ALL=(ALL) ALL\n",
+		},
+	}
+
+	for _, test := range tests {
+		content := sudoersFileContent("# NCO OWNER default-sample", SudoersFile{Name: "deploy", Content: test.content})
+		if content != test.expected {
+			t.Errorf("unexpected content:\n%s", content)
+		}
+	}
+}
+
+func TestSudoersFileName(t *testing.T) {
+	tests := []struct {
+		resource string
+		file     string
+		expected string
+	}{
+		{"default-sample", "deploy", "nco-default-sample-deploy"},
+		// sudo skips files that contain a dot
+		{"default-node.config", "deploy", "nco-default-node_config-deploy"},
+		{"default-sample", "Deploy Users.conf", "nco-default-sample-deploy_usersconf"},
+	}
+
+	for _, test := range tests {
+		config := NewSudoersConfig(Sudoers{}, logr.Discard(), test.resource)
+		if name := config.fileName(SudoersFile{Name: test.file}); name != test.expected {
+			t.Errorf("fileName(%q, %q) = %s, expected %s", test.resource, test.file, name, test.expected)
+		}
+	}
+}
+
+func TestSudoersRemoveOwnedFiles(t *testing.T) {
+	config := NewSudoersConfig(Sudoers{
+		Files: []SudoersFile{{Name: "deploy"}},
+		State: "absent",
+	}, logr.Discard(), "default-sample")
+	config.directory = t.TempDir()
+
+	other := NewSudoersConfig(Sudoers{}, logr.Discard(), "default-sample-2")
+	files := map[string]string{
+		"nco-default-sample-deploy":   sudoersFileContent(config.ownerMarker, SudoersFile{Content: "a ALL=(ALL) ALL"}),
+		"nco-default-sample-removed":  sudoersFileContent(config.ownerMarker, SudoersFile{Content: "b ALL=(ALL) ALL"}),
+		"nco-default-sample-2-deploy": sudoersFileContent(other.ownerMarker, SudoersFile{Content: "c ALL=(ALL) ALL"}),
+		"admins":                      "%admins ALL=(ALL) ALL\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(config.directory, name), []byte(content), 0440); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files of the NodeConfig that are no longer listed are deleted
+	desired := map[string]bool{config.filePath(SudoersFile{Name: "deploy"}): true}
+	if err := config.removeOwnedFiles(desired); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(t, config.directory, "admins", "nco-default-sample-2-deploy", "nco-default-sample-deploy")
+
+	if err := config.removeModule(); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(t, config.directory, "admins", "nco-default-sample-2-deploy")
+}
+
+func expectFiles(t *testing.T, directory string, expected ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("unexpected files %v, expected %v", names, expected)
+	}
+}
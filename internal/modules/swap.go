@@ -0,0 +1,391 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const procSwapsPath = "/proc/swaps"
+
+const (
+	SWAP_DISABLED = "disabled"
+	SWAP_FILE     = "swapfile"
+)
+
+// +kubebuilder:object:generate=true
+// Swap defines the swap configuration of the host
+type Swap struct {
+	// Mode of the swap. "disabled" turns off all swap devices and comments
+	// them in /etc/fstab, "swapfile" creates and enables a swap file
+	// +kubebuilder:validation:Enum=disabled;swapfile
+	Mode string `json:"mode,omitempty"`
+	// Absolute path of the swap file
+	// +kubebuilder:default:="/nco.swap"
+	Path string `json:"path,omitempty"`
+	// Size of the swap file (e.g. 4Gi)
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+	// Priority of the swap file, higher values are used first (default: -1,
+	// set by the kernel)
+	// +kubebuilder:validation:Minimum:=-1
+	// +kubebuilder:validation:Maximum:=32767
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (s Swap) IsPresent() bool {
+	if s.Mode != "" && s.State == "present" {
+		return true
+	}
+	return false
+}
+
+type SwapConfig struct {
+	Swap
+	*statusRecorder
+	logger      logr.Logger
+	beginMarker string
+	endMarker   string
+}
+
+func NewSwapConfig(swap Swap, logger logr.Logger, name string) SwapConfig {
+	return SwapConfig{
+		Swap:           swap,
+		statusRecorder: newStatusRecorder("swap"),
+		logger:         logger,
+		beginMarker:    fmt.Sprintf("# BEGIN MARKER NCO SWAP %s", name),
+		endMarker:      fmt.Sprintf("# END MARKER NCO SWAP %s", name),
+	}
+}
+
+func (s SwapConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		s.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"swap", nil}
+	if s.State == "present" {
+		s.logger.V(1).Info("applying module")
+		if err := s.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module applied")
+	} else if s.State == "absent" {
+		s.logger.V(1).Info("removing module")
+		if err := s.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module removed")
+	}
+
+	if err := s.recordSwapState(); err != nil {
+		s.logger.Error(err, "failed to read swap state")
+	}
+
+	return nil
+}
+
+func (s SwapConfig) applyModule() error {
+	switch s.Mode {
+	case SWAP_DISABLED:
+		return s.disableSwap()
+	case SWAP_FILE:
+		return s.applySwapFile()
+	}
+	return fmt.Errorf("unknown swap mode %s", s.Mode)
+}
+
+func (s SwapConfig) removeModule() error {
+	switch s.Mode {
+	case SWAP_DISABLED:
+		return s.restoreSwap()
+	case SWAP_FILE:
+		return s.removeSwapFile()
+	}
+	return nil
+}
+
+// disableSwap turns off every swap device and comments the swap entries in
+// /etc/fstab so they aren't enabled on boot
+func (s SwapConfig) disableSwap() error {
+	content, err := os.ReadFile(fstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to read fstab: %w", err)
+	}
+
+	newContent, changed := commentFstabSwap(string(content))
+	if changed {
+		if err := writeFile(fstabPath, newContent); err != nil {
+			return fmt.Errorf("failed to write fstab: %w", err)
+		}
+		s.logger.Info("swap entries disabled in fstab")
+	}
+
+	swaps, err := readSwaps()
+	if err != nil {
+		return err
+	}
+	if len(swaps) == 0 {
+		return nil
+	}
+
+	s.logger.Info("disabling swap")
+	if output, err := execHostNamespace("swapoff", "-a"); err != nil {
+		return fmt.Errorf("failed to disable swap: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// restoreSwap uncomments the swap entries disabled by the module and enables
+// them again
+func (s SwapConfig) restoreSwap() error {
+	content, err := os.ReadFile(fstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to read fstab: %w", err)
+	}
+
+	newContent, changed := uncommentDisabledLines(string(content))
+	if !changed {
+		return nil
+	}
+
+	if err := writeFile(fstabPath, newContent); err != nil {
+		return fmt.Errorf("failed to write fstab: %w", err)
+	}
+
+	if output, err := execHostNamespace("swapon", "-a"); err != nil {
+		return fmt.Errorf("failed to enable swap: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// applySwapFile creates the swap file with the desired size, adds it to
+// /etc/fstab and enables it with the desired priority
+func (s SwapConfig) applySwapFile() error {
+	if err := validateFilePath(s.Path); err != nil {
+		return err
+	}
+	if s.Size == nil || s.Size.Value() <= 0 {
+		return errors.New("size is required for swap files")
+	}
+
+	size := s.Size.Value()
+	hostPath := "/host" + s.Path
+
+	swaps, err := readSwaps()
+	if err != nil {
+		return err
+	}
+	active, isActive := swaps[s.Path]
+
+	info, err := os.Stat(hostPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check swap file: %w", err)
+	}
+	needsCreate := err != nil || info.Size() != size
+
+	// A file of the right size may have no signature if a previous mkswap
+	// failed, so it's created again unless it's already in use
+	if !needsCreate && !isActive && !hasSwapSignature(s.Path) {
+		s.logger.Info("swap file has no swap signature", "path", s.Path)
+		needsCreate = true
+	}
+
+	if needsCreate {
+		if isActive {
+			s.logger.Info("disabling swap file to resize it", "path", s.Path)
+			if output, err := execHostNamespace("swapoff", s.Path); err != nil {
+				return fmt.Errorf("failed to disable swap file: %s", strings.TrimSpace(string(output)))
+			}
+			isActive = false
+		}
+
+		if err := s.createSwapFile(size); err != nil {
+			return err
+		}
+	}
+
+	options := "sw"
+	if s.Priority != nil {
+		options = fmt.Sprintf("sw,pri=%d", *s.Priority)
+	}
+	block := fmt.Sprintf("%s none swap %s 0 0", escapeFstabField(s.Path), options)
+	err = writeBlockToFile(fstabPath, []byte(s.beginMarker), []byte(s.endMarker), []byte(block))
+	if err != nil {
+		return fmt.Errorf("failed to write fstab entry: %w", err)
+	}
+
+	if isActive && s.Priority != nil && active.priority != *s.Priority {
+		s.logger.Info("disabling swap file to change its priority", "path", s.Path)
+		if output, err := execHostNamespace("swapoff", s.Path); err != nil {
+			return fmt.Errorf("failed to disable swap file: %s", strings.TrimSpace(string(output)))
+		}
+		isActive = false
+	}
+
+	if isActive {
+		return nil
+	}
+
+	args := []string{"swapon"}
+	if s.Priority != nil {
+		args = append(args, "--priority", strconv.Itoa(*s.Priority))
+	}
+	s.logger.Info("enabling swap file", "path", s.Path)
+	if output, err := execHostNamespace(append(args, s.Path)...); err != nil {
+		return fmt.Errorf("failed to enable swap file: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func (s SwapConfig) createSwapFile(size int64) error {
+	s.logger.Info("creating swap file", "path", s.Path, "size", size)
+	hostPath := "/host" + s.Path
+	if err := deleteFileIfExists(hostPath); err != nil {
+		return fmt.Errorf("failed to delete previous swap file: %w", err)
+	}
+
+	// Swap files can't have holes, so the blocks are allocated instead of
+	// truncating the file
+	output, err := execChroot("fallocate", "-l", strconv.FormatInt(size, 10), s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to allocate swap file: %s", strings.TrimSpace(string(output)))
+	}
+
+	if err := os.Chmod(hostPath, 0600); err != nil {
+		return fmt.Errorf("failed to set swap file permissions: %w", err)
+	}
+
+	output, err = execChroot("mkswap", s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to format swap file: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// hasSwapSignature returns true if blkid detects a swap signature in the file
+func hasSwapSignature(path string) bool {
+	output, err := execChroot("blkid", "-p", "-s", "TYPE", "-o", "value", path)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(output)) == "swap"
+}
+
+func (s SwapConfig) removeSwapFile() error {
+	swaps, err := readSwaps()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := swaps[s.Path]; ok {
+		s.logger.Info("disabling swap file", "path", s.Path)
+		if output, err := execHostNamespace("swapoff", s.Path); err != nil {
+			return fmt.Errorf("failed to disable swap file: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	if err := deleteBlockFromFile(fstabPath, []byte(s.beginMarker), []byte(s.endMarker)); err != nil {
+		return fmt.Errorf("failed to remove fstab entry: %w", err)
+	}
+
+	if err := deleteFileIfExists("/host" + s.Path); err != nil {
+		return fmt.Errorf("failed to delete swap file: %w", err)
+	}
+
+	return nil
+}
+
+// recordSwapState reports the active swap devices in the module status
+func (s SwapConfig) recordSwapState() error {
+	swaps, err := readSwaps()
+	if err != nil {
+		return err
+	}
+
+	if len(swaps) == 0 {
+		s.record("", "no active swap")
+		return nil
+	}
+
+	for name, swap := range swaps {
+		s.record(name, fmt.Sprintf("type=%s size=%dkB used=%dkB priority=%d",
+			swap.swapType, swap.sizeKB, swap.usedKB, swap.priority))
+	}
+	return nil
+}
+
+type swapEntry struct {
+	swapType string
+	sizeKB   int64
+	usedKB   int64
+	priority int
+}
+
+func readSwaps() (map[string]swapEntry, error) {
+	content, err := os.ReadFile(procSwapsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", procSwapsPath, err)
+	}
+
+	return parseSwaps(string(content)), nil
+}
+
+// parseSwaps returns the entries of /proc/swaps indexed by file name
+func parseSwaps(content string) map[string]swapEntry {
+	swaps := map[string]swapEntry{}
+	for i, line := range strings.Split(content, "\n") {
+		// Filename  Type  Size  Used  Priority
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) != 5 {
+			continue
+		}
+
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		used, _ := strconv.ParseInt(fields[3], 10, 64)
+		priority, _ := strconv.Atoi(fields[4])
+		swaps[unescapeMountInfo(fields[0])] = swapEntry{
+			swapType: fields[1],
+			sizeKB:   size,
+			usedKB:   used,
+			priority: priority,
+		}
+	}
+
+	return swaps
+}
+
+// commentFstabSwap comments the active swap entries of an fstab file
+func commentFstabSwap(content string) (string, bool) {
+	changed := false
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || fields[2] != "swap" {
+			continue
+		}
+
+		lines[i] = disabledLinePrefix + line
+		changed = true
+	}
+
+	return strings.Join(lines, "\n"), changed
+}
@@ -0,0 +1,61 @@
+package modules
+
+import "testing"
+
+func TestParseSwaps(t *testing.T) {
+	content := `Filename				Type		Size		Used		Priority
+/dev/dm-1                               partition	8388604		1024		-2
+/nco\040swap                            file		4194300		0		10
+`
+	swaps := parseSwaps(content)
+	if len(swaps) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(swaps))
+	}
+
+	partition := swaps["/dev/dm-1"]
+	if partition.swapType != "partition" || partition.sizeKB != 8388604 || partition.usedKB != 1024 || partition.priority != -2 {
+		t.Errorf("unexpected partition entry: %+v", partition)
+	}
+
+	file, ok := swaps["/nco swap"]
+	if !ok {
+		t.Fatalf("escaped file name not found: %v", swaps)
+	}
+	if file.swapType != "file" || file.priority != 10 {
+		t.Errorf("unexpected file entry: %+v", file)
+	}
+
+	if len(parseSwaps("Filename Type Size Used Priority\n")) != 0 {
+		t.Error("expected no entries")
+	}
+}
+
+func TestCommentFstabSwap(t *testing.T) {
+	fstab := `UUID=abc / ext4 defaults 0 1
+/swap.img none swap sw 0 0
+# /old.swap none swap sw 0 0
+UUID=def none swap sw 0 0
+`
+	commented, changed := commentFstabSwap(fstab)
+	if !changed {
+		t.Fatal("expected fstab to change")
+	}
+
+	expected := `UUID=abc / ext4 defaults 0 1
+#NCO-DISABLED# /swap.img none swap sw 0 0
+# /old.swap none swap sw 0 0
+#NCO-DISABLED# UUID=def none swap sw 0 0
+`
+	if commented != expected {
+		t.Errorf("unexpected commented fstab:\n%s", commented)
+	}
+
+	if _, changed := commentFstabSwap(commented); changed {
+		t.Error("commenting twice should not change the fstab")
+	}
+
+	restored, changed := uncommentDisabledLines(commented)
+	if !changed || restored != fstab {
+		t.Errorf("unexpected restored fstab:\n%s", restored)
+	}
+}
@@ -0,0 +1,279 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const sysfsScriptsPath = "/etc/nco"
+
+// +kubebuilder:object:generate=true
+// SysfsAttributes defines the values of attributes in /sys
+type SysfsAttributes struct {
+	Attributes []SysfsAttribute `json:"attributes,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (s SysfsAttributes) IsPresent() bool {
+	if len(s.Attributes) != 0 && s.State == "present" {
+		return true
+	}
+	return false
+}
+
+type SysfsAttribute struct {
+	// Path of the attribute, glob patterns are allowed
+	// (e.g. /sys/block/nvme*/queue/scheduler)
+	// +kubebuilder:validation:Pattern=`^/sys/[A-Za-z0-9_.:*?\[\]/-]+$`
+	Path string `json:"path"`
+	// Desired value of the attribute
+	Value string `json:"value"`
+}
+
+type SysfsAttributesConfig struct {
+	SysfsAttributes
+	*statusRecorder
+	logger     logr.Logger
+	unitName   string
+	scriptPath string
+}
+
+func NewSysfsAttributesConfig(attributes SysfsAttributes, logger logr.Logger, name string) SysfsAttributesConfig {
+	return SysfsAttributesConfig{
+		SysfsAttributes: attributes,
+		statusRecorder:  newStatusRecorder("sysfsAttributes"),
+		logger:          logger,
+		unitName:        fmt.Sprintf("nco-sysfs-%s.service", name),
+		scriptPath:      fmt.Sprintf("%s/sysfs-%s.sh", sysfsScriptsPath, name),
+	}
+}
+
+func (s SysfsAttributesConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		s.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"sysfsAttributes", nil}
+	if s.State == "present" {
+		s.logger.V(1).Info("applying module")
+		if err := s.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module applied")
+	} else if s.State == "absent" {
+		s.logger.V(1).Info("removing module")
+		if err := s.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		s.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (s SysfsAttributesConfig) applyModule() error {
+	for _, attribute := range s.Attributes {
+		if !sysfsPathRegexp.MatchString(attribute.Path) || strings.Contains(attribute.Path, "..") {
+			return fmt.Errorf("invalid sysfs path %s", attribute.Path)
+		}
+	}
+
+	if err := s.persistAttributes(); err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, attribute := range s.Attributes {
+		paths, err := filepath.Glob(attribute.Path)
+		if err != nil {
+			return fmt.Errorf("invalid glob %s: %w", attribute.Path, err)
+		}
+		if len(paths) == 0 {
+			s.record(attribute.Path, "no attributes match the path")
+			continue
+		}
+
+		for _, path := range paths {
+			if err := s.applyAttribute(path, attribute.Value); err != nil {
+				s.logger.Error(err, "failed to apply attribute", "path", path)
+				s.record(path, err.Error())
+				failed = append(failed, path)
+			}
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("failed to apply attributes: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func (s SysfsAttributesConfig) removeModule() error {
+	exists, err := checkFileExists(systemdPath + "/" + s.unitName)
+	if err != nil {
+		return fmt.Errorf("failed to check unit: %w", err)
+	}
+
+	if exists {
+		if output, err := execChroot("systemctl", "disable", s.unitName); err != nil {
+			return fmt.Errorf("failed to disable %s: %s", s.unitName, strings.TrimSpace(string(output)))
+		}
+		if err := deleteFileIfExists(systemdPath + "/" + s.unitName); err != nil {
+			return fmt.Errorf("failed to delete unit: %w", err)
+		}
+		if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+	}
+	if err := newPendingAction("sysfsAttributes", s.unitName).done(); err != nil {
+		return err
+	}
+
+	if err := deleteFileIfExists("/host" + s.scriptPath); err != nil {
+		return fmt.Errorf("failed to delete script: %w", err)
+	}
+
+	// The current values are kept until the next reboot
+	return nil
+}
+
+// applyAttribute writes the value if it differs from the current one and
+// verifies that the kernel accepted it
+func (s SysfsAttributesConfig) applyAttribute(path, value string) error {
+	current, err := readSysfsAttribute(path)
+	if err != nil {
+		return err
+	}
+	if current == value {
+		return nil
+	}
+
+	s.logger.Info("setting sysfs attribute", "path", path, "value", value, "previous", current)
+	if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write value: %w", err)
+	}
+
+	current, err = readSysfsAttribute(path)
+	if err != nil {
+		return err
+	}
+	if current != value {
+		return fmt.Errorf("value is %q after writing %q", current, value)
+	}
+
+	return nil
+}
+
+// persistAttributes writes a script that sets the attributes and a oneshot
+// unit that runs it on boot
+func (s SysfsAttributesConfig) persistAttributes() error {
+	script := sysfsScriptContent(s.Attributes)
+	scriptCurrent, err := checkFileContents("/host"+s.scriptPath, script)
+	if err != nil {
+		return fmt.Errorf("failed to check script contents: %w", err)
+	}
+	if !scriptCurrent {
+		if err := writeFile("/host"+s.scriptPath, script); err != nil {
+			return fmt.Errorf("failed to write script: %w", err)
+		}
+	}
+
+	unit := fmt.Sprintf(`%s
+[Unit]
+Description=Set sysfs attributes managed by NCO
+After=systemd-modules-load.service systemd-udev-settle.service
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/sh %s
+
+[Install]
+WantedBy=multi-user.target
+`, overrideHeader, s.scriptPath)
+
+	unitPath := systemdPath + "/" + s.unitName
+	unitCurrent, err := checkFileContents(unitPath, unit)
+	if err != nil {
+		return fmt.Errorf("failed to check unit contents: %w", err)
+	}
+
+	// The unit is enabled from a pending action, so it's retried in the next
+	// reconciliations if systemctl fails
+	pending := newPendingAction("sysfsAttributes", s.unitName)
+	if !unitCurrent {
+		if err := writeFile(unitPath, unit); err != nil {
+			return fmt.Errorf("failed to write unit: %w", err)
+		}
+		if err := pending.mark(); err != nil {
+			return err
+		}
+	}
+
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+	if _, err := execChroot("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload daemon: %w", err)
+	}
+	if output, err := execChroot("systemctl", "enable", s.unitName); err != nil {
+		return fmt.Errorf("failed to enable %s: %s", s.unitName, strings.TrimSpace(string(output)))
+	}
+
+	return pending.done()
+}
+
+var sysfsPathRegexp = regexp.MustCompile(`^/sys/[A-Za-z0-9_.:*?\[\]/-]+$`)
+
+// sysfsScriptContent returns a shell script that sets the attributes. The
+// paths are expanded by the shell so devices are matched on every boot
+func sysfsScriptContent(attributes []SysfsAttribute) string {
+	lines := []string{"#!/bin/sh", overrideHeader}
+	for _, attribute := range attributes {
+		value := "'" + strings.ReplaceAll(attribute.Value, "'", `'\''`) + "'"
+		lines = append(lines,
+			fmt.Sprintf("for f in %s; do", attribute.Path),
+			fmt.Sprintf("\tif [ -e \"$f\" ]; then echo %s > \"$f\"; fi", value),
+			"done",
+		)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// readSysfsAttribute returns the value of an attribute. For attributes that
+// list the options with the selected one between brackets, like
+// "none [mq-deadline] kyber", only the selected option is returned
+func readSysfsAttribute(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read value: %w", err)
+	}
+
+	return parseSysfsValue(string(content)), nil
+}
+
+func parseSysfsValue(content string) string {
+	value := strings.TrimSpace(content)
+	for _, field := range strings.Fields(value) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			return strings.Trim(field, "[]")
+		}
+	}
+	return value
+}
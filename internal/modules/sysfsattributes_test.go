@@ -0,0 +1,38 @@
+package modules
+
+import "testing"
+
+func TestParseSysfsValue(t *testing.T) {
+	tests := map[string]string{
+		"none [mq-deadline] kyber\n": "mq-deadline",
+		"always [madvise] never\n":   "madvise",
+		"128\n":                      "128",
+		"performance":                "performance",
+	}
+
+	for content, expected := range tests {
+		if value := parseSysfsValue(content); value != expected {
+			t.Errorf("parseSysfsValue(%q) = %q, expected %q", content, value, expected)
+		}
+	}
+}
+
+func TestSysfsScriptContent(t *testing.T) {
+	content := sysfsScriptContent([]SysfsAttribute{
+		{Path: "/sys/block/nvme*/queue/scheduler", Value: "none"},
+		{Path: "/sys/kernel/test", Value: "it's"},
+	})
+
+	expected := `#!/bin/sh
+` + overrideHeader + `
+for f in /sys/block/nvme*/queue/scheduler; do
+	if [ -e "$f" ]; then echo 'none' > "$f"; fi
+done
+for f in /sys/kernel/test; do
+	if [ -e "$f" ]; then echo 'it'\''s' > "$f"; fi
+done
+`
+	if content != expected {
+		t.Errorf("unexpected script:\n%s", content)
+	}
+}
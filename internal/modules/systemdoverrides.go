@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -15,14 +16,19 @@ const (
 	overrideHeader   = "# FILE MANAGED BY NCO - CHANGES TO THIS FILE WILL BE OVERWRITTEN"
 )
 
-const (
-	SERVICE_TYPE = "service"
-	SLICE_TYPE   = "slice"
-)
+var systemdOverrideUnitTypes = []string{
+	"service", "socket", "timer", "path", "mount", "automount", "swap", "slice", "scope", "target", "device",
+}
 
 // +kubebuilder:object:generate=true
 type SystemdOverrides struct {
 	Overrides []SystemdOverride `json:"overrides,omitempty"`
+	// Seconds to wait for a unit to be active after restarting or reloading
+	// it (default: 30)
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=30
+	// +optional
+	ReadinessTimeout *int `json:"readinessTimeout,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 }
@@ -37,7 +43,8 @@ func (s SystemdOverrides) IsPresent() bool {
 
 // +kubebuilder:object:generate=true
 type SystemdOverride struct {
-	// Name of unit to override, must have service or slice suffix
+	// Name of unit to override, including its type suffix (e.g.
+	// kubelet.service or docker.socket)
 	Name string `json:"name"`
 	// Contents of file
 	File string `json:"file"`
@@ -47,6 +54,12 @@ type SystemdOverride struct {
 	// +kubebuilder:default:=50
 	// +optional
 	Priority *int `json:"priority,omitempty"`
+	// What to do with the unit when the override changes: "true" restarts
+	// it, "reload" reloads it and "false" does nothing. If it's not set,
+	// only services are restarted
+	// +kubebuilder:validation:Enum="true";"false";"reload"
+	// +optional
+	Restart string `json:"restart,omitempty"`
 }
 
 type systemdOverride struct {
@@ -54,43 +67,73 @@ type systemdOverride struct {
 	unitType    string
 	fileContent string
 	priority    *int
+	restart     string
 }
 
 type SystemdOverrideConfig struct {
-	overrides    []systemdOverride
-	state        string
-	logger       logr.Logger
-	resourceName string
+	overrides        []systemdOverride
+	state            string
+	readinessTimeout time.Duration
+	logger           logr.Logger
+	resourceName     string
 }
 
 func NewSystemdOverrideConfig(overrides SystemdOverrides, logger logr.Logger, name string) SystemdOverrideConfig {
 	ov := make([]systemdOverride, len(overrides.Overrides))
 
 	for i, override := range overrides.Overrides {
-		var unitType string
-		if strings.HasSuffix(override.Name, ".service") {
-			unitType = SERVICE_TYPE
-		} else if strings.HasSuffix(override.Name, ".slice") {
-			unitType = SLICE_TYPE
-		} else {
-			logger.Info("Warning: unit type not supported", "unitName", override.Name)
-			continue
-		}
-
 		ov[i] = systemdOverride{
 			unitName:    override.Name,
-			unitType:    unitType,
+			unitType:    systemdOverrideUnitType(override.Name),
 			fileContent: override.File,
 			priority:    override.Priority,
+			restart:     override.Restart,
 		}
 	}
 
+	readinessTimeout := 30
+	if overrides.ReadinessTimeout != nil {
+		readinessTimeout = *overrides.ReadinessTimeout
+	}
+
 	return SystemdOverrideConfig{
-		overrides:    ov,
-		state:        overrides.State,
-		logger:       logger,
-		resourceName: name,
+		overrides:        ov,
+		state:            overrides.State,
+		readinessTimeout: time.Duration(readinessTimeout) * time.Second,
+		logger:           logger,
+		resourceName:     name,
+	}
+}
+
+// systemdOverrideUnitType returns the type of the unit from the suffix of its
+// name, or an empty string if it's not a known type
+func systemdOverrideUnitType(unitName string) string {
+	for _, unitType := range systemdOverrideUnitTypes {
+		if strings.HasSuffix(unitName, "."+unitType) {
+			return unitType
+		}
+	}
+	return ""
+}
+
+// restartAction returns the systemctl command to run when the override of the
+// unit changes, or an empty string if nothing must be done
+func (o systemdOverride) restartAction() string {
+	switch o.restart {
+	case "true":
+		return "restart"
+	case "reload":
+		return "reload"
+	case "false":
+		return ""
 	}
+
+	// slices and other units are not restarted by default, their overrides
+	// apply to new processes or on system boot
+	if o.unitType == "service" {
+		return "restart"
+	}
+	return ""
 }
 
 func (s SystemdOverrideConfig) Reconcile() error {
@@ -122,8 +165,12 @@ func (s SystemdOverrideConfig) Reconcile() error {
 }
 
 func (s SystemdOverrideConfig) applyModule() error {
-	needsRestart := make([]bool, len(s.overrides))
-	for i, override := range s.overrides {
+	var changed []systemdOverride
+	for _, override := range s.overrides {
+		if override.unitType == "" {
+			return fmt.Errorf("unit %s doesn't have a valid type suffix", override.unitName)
+		}
+
 		folderPath := fmt.Sprintf("%s/%s.d", overrideBasePath, override.unitName)
 
 		// delete previous file as it's not needed anymore
@@ -136,8 +183,7 @@ func (s SystemdOverrideConfig) applyModule() error {
 		// `/etc/systemd/system/<unit-name>.d/<override-file>`, for example
 		// `/etc/systemd/system/getty@tty2.service.d/override.conf`so we build
 		// the complete file path with the unit information
-		overrideName := fmt.Sprintf("%d-nco-%s-override.conf", *override.priority, s.resourceName)
-		filePath := fmt.Sprintf("%s/%s", folderPath, overrideName)
+		filePath := s.overridePath(override)
 		content := overrideHeader + "\n" + override.fileContent
 
 		if err := checkOrCreateDirectory(folderPath); err != nil {
@@ -153,34 +199,15 @@ func (s SystemdOverrideConfig) applyModule() error {
 			if err := writeFile(filePath, content); err != nil {
 				return fmt.Errorf("failed to write file: %w", err)
 			}
-			needsRestart[i] = true
+			changed = append(changed, override)
 		}
 	}
 
-	// Reload systemd configuration
-	_, err := execChroot("systemctl", "daemon-reload")
-	if err != nil {
-		return fmt.Errorf("failed to reload daemon: %w", err)
-	}
-
-	for i, override := range s.overrides {
-		// Services will be restarted to load its new configuration when the
-		// override has changed.
-		// The slice's override will apply to new processes or to all processes
-		// on system boot
-		if override.unitType != SERVICE_TYPE || !needsRestart[i] {
-			continue
-		}
-
-		_, err := execChroot("systemctl", "restart", override.unitName)
-		if err != nil {
-			return fmt.Errorf("failed to restart service: %w", err)
-		}
-	}
-	return nil
+	return s.reloadUnits(changed)
 }
 
 func (s SystemdOverrideConfig) removeModule() error {
+	var changed []systemdOverride
 	for _, override := range s.overrides {
 		folderPath := fmt.Sprintf("%s/%s.d", overrideBasePath, override.unitName)
 
@@ -190,30 +217,107 @@ func (s SystemdOverrideConfig) removeModule() error {
 			return fmt.Errorf("failed to delete prevFileName: %w", err)
 		}
 
-		overrideName := fmt.Sprintf("%d-nco-%s-override.conf", *override.priority, s.resourceName)
-		filePath := fmt.Sprintf("%s/%s", folderPath, overrideName)
+		filePath := s.overridePath(override)
+		exists, err := checkFileExists(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to check file: %w", err)
+		}
+		if !exists {
+			continue
+		}
 
 		if err := deleteFileIfExists(filePath); err != nil {
 			return fmt.Errorf("failed to delete file: %w", err)
 		}
+		changed = append(changed, override)
 	}
 
-	// Reload systemd configuration
-	_, err := execChroot("systemctl", "daemon-reload")
+	return s.reloadUnits(changed)
+}
+
+// reloadUnits reloads the systemd configuration and restarts the units whose
+// override changed one at a time, waiting for each one to be active before
+// restarting the next one. The reload and the restarts are recorded as
+// pending actions and cleared once they succeed, so they're retried in the
+// next reconciliations
+func (s SystemdOverrideConfig) reloadUnits(changed []systemdOverride) error {
+	reload := newPendingAction("systemdOverrides", "daemon-reload")
+	if len(changed) != 0 {
+		if err := reload.mark(); err != nil {
+			return err
+		}
+	}
+	for _, override := range changed {
+		if err := s.unitAction(override).mark(); err != nil {
+			return err
+		}
+	}
+
+	isPending, err := reload.isPending()
 	if err != nil {
-		return fmt.Errorf("failed to reload daemon: %w", err)
+		return err
+	}
+	if isPending {
+		_, err := execChroot("systemctl", "daemon-reload")
+		if err != nil {
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+		if err := reload.done(); err != nil {
+			return err
+		}
 	}
 
 	for _, override := range s.overrides {
-		if override.unitType != SERVICE_TYPE {
+		pending := s.unitAction(override)
+		isPending, err := pending.isPending()
+		if err != nil {
+			return err
+		}
+		if !isPending {
 			continue
 		}
 
-		_, err := execChroot("systemctl", "restart", override.unitName)
-		if err != nil {
-			return fmt.Errorf("failed to restart service: %w", err)
+		if err := s.applyToUnit(override); err != nil {
+			return err
+		}
+		if err := pending.done(); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// unitAction is recorded when the override of the unit changes
+func (s SystemdOverrideConfig) unitAction(override systemdOverride) pendingAction {
+	return newPendingAction("systemdOverrides", s.overridePath(override))
+}
+
+// applyToUnit restarts or reloads the unit so it uses its overrides
+func (s SystemdOverrideConfig) applyToUnit(override systemdOverride) error {
+	action := override.restartAction()
+	if action == "" {
+		return nil
+	}
+
+	if action == "reload" {
+		// a unit that isn't running loads its configuration when it's
+		// started
+		if _, err := execChroot("systemctl", "is-active", "--quiet", override.unitName); err != nil {
+			return nil
+		}
+	}
+
+	s.logger.Info("applying override to unit", "unit", override.unitName, "action", action)
+	output, err := execChroot("systemctl", action, override.unitName)
+	if err != nil {
+		return fmt.Errorf("failed to %s %s: %s", action, override.unitName, strings.TrimSpace(string(output)))
+	}
+
+	return waitForUnit(override.unitName, s.readinessTimeout)
+}
+
+func (s SystemdOverrideConfig) overridePath(override systemdOverride) string {
+	overrideName := fmt.Sprintf("%d-nco-%s-override.conf", *override.priority, s.resourceName)
+	return fmt.Sprintf("%s/%s.d/%s", overrideBasePath, override.unitName, overrideName)
+}
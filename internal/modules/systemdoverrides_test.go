@@ -0,0 +1,42 @@
+package modules
+
+import "testing"
+
+func TestSystemdOverrideRestartAction(t *testing.T) {
+	tests := []struct {
+		name, restart, expected string
+	}{
+		{"kubelet.service", "", "restart"},
+		{"kubepods.slice", "", ""},
+		{"docker.socket", "", ""},
+		{"docker.socket", "true", "restart"},
+		{"containerd.service", "reload", "reload"},
+		{"containerd.service", "false", ""},
+	}
+
+	for _, test := range tests {
+		override := systemdOverride{
+			unitName: test.name,
+			unitType: systemdOverrideUnitType(test.name),
+			restart:  test.restart,
+		}
+		if action := override.restartAction(); action != test.expected {
+			t.Errorf("restartAction() for %s with restart %q = %q, expected %q", test.name, test.restart, action, test.expected)
+		}
+	}
+}
+
+func TestSystemdOverrideUnitType(t *testing.T) {
+	tests := map[string]string{
+		"getty@tty2.service": "service",
+		"mnt-data.mount":     "mount",
+		"fstrim.timer":       "timer",
+		"kubelet":            "",
+	}
+
+	for name, expected := range tests {
+		if unitType := systemdOverrideUnitType(name); unitType != expected {
+			t.Errorf("systemdOverrideUnitType(%q) = %q, expected %q", name, unitType, expected)
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -14,6 +16,12 @@ import (
 // +kubebuilder:object:generate=true
 type SystemdUnits struct {
 	Units []SystemdUnit `json:"units,omitempty"`
+	// Seconds to wait for a unit to be ready after starting or restarting it
+	// (default: 30)
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=30
+	// +optional
+	ReadinessTimeout *int `json:"readinessTimeout,omitempty"`
 	// +kubebuilder:Enum="present";"absent"
 	State string `json:"state,omitempty"`
 }
@@ -26,63 +34,154 @@ func (s SystemdUnits) IsPresent() bool {
 	return false
 }
 
+// +kubebuilder:object:generate=true
 type SystemdUnit struct {
-	// Name of the service. A "nco" prefix will be appended
+	// Name of the unit. A "nco-" prefix will be appended, except for mount
+	// units, whose name must match the escaped mount path (e.g. mnt-data)
 	Name string `json:"name"`
+	// Type of the unit. If it's not set, it's taken from the suffix of the
+	// name, or service if the name has no suffix
+	// +kubebuilder:validation:Enum=service;timer;socket;path;target;mount
+	// +optional
+	Type string `json:"type,omitempty"`
 	// Contents of the systemd unit
-	File string `json:"file"`
+	// +optional
+	File string `json:"file,omitempty"`
+	// Enable the unit to start it on boot. If it's not set, units that are
+	// not services are enabled and services are left as they are
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// When to restart the unit if it's running: OnChange restarts it when
+	// its file changes, Always when any unit of the list changes and Never
+	// doesn't restart it
+	// +kubebuilder:validation:Enum=OnChange;Always;Never
+	// +kubebuilder:default:=OnChange
+	// +optional
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+	// State of the unit. Masked units are stopped and can't be started
+	// +kubebuilder:validation:Enum=started;stopped;masked
+	// +kubebuilder:default:=started
+	// +optional
+	DesiredState string `json:"desiredState,omitempty"`
 }
 
+var systemdUnitTypes = []string{"service", "timer", "socket", "path", "target", "mount"}
+
 type systemdUnit struct {
-	absPath      string
-	serviceName  string
-	fileContents string
+	absPath       string
+	unitName      string
+	unitType      string
+	fileContents  string
+	enabled       *bool
+	restartPolicy string
+	desiredState  string
+	// triggered is set for services activated by a timer, socket or path
+	// unit of the same name, which are not started directly
+	triggered bool
+}
+
+// isActivator returns true for units that start another unit when they're
+// triggered
+func (u systemdUnit) isActivator() bool {
+	return u.unitType == "timer" || u.unitType == "socket" || u.unitType == "path"
+}
+
+// shouldEnable returns if the unit must be enabled, and false if it's left as
+// it is
+func (u systemdUnit) shouldEnable() (bool, bool) {
+	if u.enabled != nil {
+		return *u.enabled, true
+	}
+	if u.unitType != "service" {
+		return true, true
+	}
+	return false, false
 }
 
 type SystemdUnitConfig struct {
-	units  []systemdUnit
-	state  string
+	units            []systemdUnit
+	state            string
+	readinessTimeout time.Duration
+	ownerMarker      string
+	*statusRecorder
 	logger logr.Logger
 }
 
 const systemdPath = "/host/etc/systemd/system"
 
-func NewSystemdUnitConfig(units SystemdUnits, logger logr.Logger) SystemdUnitConfig {
+func NewSystemdUnitConfig(units SystemdUnits, logger logr.Logger, name string) SystemdUnitConfig {
 	s := make([]systemdUnit, len(units.Units))
+	activators := map[string]bool{}
+	ownerMarker := fmt.Sprintf("# NCO OWNER %s", name)
 
 	for i, unit := range units.Units {
-		serviceName := "nco-" + unit.Name
+		baseName, unitType := systemdUnitName(unit.Name, unit.Type)
 
-		if strings.HasSuffix(serviceName, ".timer") {
-			logger.Info("Warning: service shouldn't be of type timer", "serviceName", serviceName)
-			continue
+		// Mount units keep the name systemd derives from their path, so
+		// they're marked with the NodeConfig that owns them
+		fileContents := unit.File
+		if unitType == "mount" && fileContents != "" {
+			fileContents = overrideHeader + "\n" + ownerMarker + "\n" + fileContents
 		}
 
-		if strings.HasSuffix(serviceName, ".socket") {
-			logger.Info("Warning: service shouldn't be of type socket", "serviceName", serviceName)
-			continue
+		s[i] = systemdUnit{
+			unitName:      baseName + "." + unitType,
+			unitType:      unitType,
+			absPath:       systemdPath + "/" + baseName + "." + unitType,
+			fileContents:  fileContents,
+			enabled:       unit.Enabled,
+			restartPolicy: unit.RestartPolicy,
+			desiredState:  unit.DesiredState,
 		}
 
-		if strings.HasSuffix(serviceName, ".service") {
-			serviceName = strings.TrimSuffix(serviceName, ".service")
+		if s[i].isActivator() {
+			activators[baseName] = true
 		}
+	}
 
-		absPath := systemdPath + "/" + serviceName + ".service"
-
-		s[i] = systemdUnit{
-			serviceName:  serviceName,
-			absPath:      absPath,
-			fileContents: unit.File,
+	for i := range s {
+		baseName := strings.TrimSuffix(s[i].unitName, ".service")
+		if s[i].unitType == "service" && activators[baseName] {
+			s[i].triggered = true
 		}
 	}
 
+	readinessTimeout := 30
+	if units.ReadinessTimeout != nil {
+		readinessTimeout = *units.ReadinessTimeout
+	}
+
 	return SystemdUnitConfig{
-		units:  s,
-		state:  units.State,
-		logger: logger,
+		units:            s,
+		state:            units.State,
+		readinessTimeout: time.Duration(readinessTimeout) * time.Second,
+		ownerMarker:      ownerMarker,
+		statusRecorder:   newStatusRecorder("systemdUnits"),
+		logger:           logger,
 	}
 }
 
+// systemdUnitName returns the name of the unit without its suffix and its
+// type. The type is taken from the suffix of the name when it's not set
+func systemdUnitName(name, unitType string) (string, string) {
+	if unitType == "" {
+		unitType = "service"
+		for _, t := range systemdUnitTypes {
+			if strings.HasSuffix(name, "."+t) {
+				unitType = t
+				break
+			}
+		}
+	}
+
+	baseName := strings.TrimSuffix(name, "."+unitType)
+	if unitType != "mount" {
+		baseName = "nco-" + baseName
+	}
+
+	return baseName, unitType
+}
+
 func (s SystemdUnitConfig) Reconcile() error {
 	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
 	if hostFsEnabled != "true" {
@@ -117,65 +216,308 @@ func (s SystemdUnitConfig) applyConfig() error {
 		return fmt.Errorf("failed to create systemd user directory: %w", err)
 	}
 
-	isCurrent, err := s.checkCurrentConfig()
-	if err != nil {
-		return fmt.Errorf("failed to check current configuration: %w", err)
+	// Only the units whose file changed are written and restarted
+	changed := map[string]bool{}
+	for _, unit := range s.units {
+		isChanged, err := s.updateUnitFile(unit)
+		if err != nil {
+			return err
+		}
+		changed[unit.unitName] = isChanged
 	}
 
-	if isCurrent {
-		// do nothing
-		return nil
+	anyChanged := false
+	for _, isChanged := range changed {
+		anyChanged = anyChanged || isChanged
 	}
 
+	// The reload and the restarts are recorded as pending actions and cleared
+	// once they succeed, so they're retried in the next reconciliations
+	reload := newPendingAction("systemdUnits", "daemon-reload")
+	if anyChanged {
+		if err := reload.mark(); err != nil {
+			return err
+		}
+	}
 	for _, unit := range s.units {
-		err := writeFile(unit.absPath, unit.fileContents)
+		restart := false
+		switch unit.restartPolicy {
+		case "Always":
+			restart = anyChanged
+		case "Never":
+		default:
+			restart = changed[unit.unitName]
+		}
+
+		if restart && unit.desiredState != "masked" {
+			if err := restartAction(unit).mark(); err != nil {
+				return err
+			}
+		}
+	}
+
+	isPending, err := reload.isPending()
+	if err != nil {
+		return err
+	}
+	if isPending {
+		_, err = execChroot("systemctl", "daemon-reload")
 		if err != nil {
-			return fmt.Errorf("failed to write file: %w", err)
+			return fmt.Errorf("failed to reload daemon: %w", err)
+		}
+		if err := reload.done(); err != nil {
+			return err
+		}
+	}
+
+	// Activators are started last, so the units they trigger are already
+	// loaded
+	for _, activators := range []bool{false, true} {
+		for _, unit := range s.units {
+			if unit.isActivator() != activators || unit.desiredState == "masked" {
+				continue
+			}
+
+			pending := restartAction(unit)
+			restart, err := pending.isPending()
+			if err != nil {
+				return err
+			}
+			if err := s.reconcileUnit(unit, restart); err != nil {
+				return err
+			}
+			if err := pending.done(); err != nil {
+				return err
+			}
 		}
 	}
 
-	// Reload services
-	_, err = execChroot("systemctl", "daemon-reload")
+	s.recordTimers()
+	return nil
+}
+
+// restartAction is recorded when the unit must be restarted after a change
+func restartAction(unit systemdUnit) pendingAction {
+	return newPendingAction("systemdUnits", unit.unitName)
+}
+
+// updateUnitFile writes the unit file, or masks the unit, and returns true if
+// anything changed
+func (s SystemdUnitConfig) updateUnitFile(unit systemdUnit) (bool, error) {
+	isOwned, err := s.isUnitOwned(unit)
 	if err != nil {
-		return fmt.Errorf("failed to reload daemon: %w", err)
+		return false, err
+	}
+	if !isOwned {
+		return false, fmt.Errorf("unit file %s is not managed by this NodeConfig", unit.unitName)
 	}
 
-	for _, unit := range s.units {
-		_, err := execChroot("systemctl", "start", unit.serviceName)
+	isMasked, err := isUnitMasked(unit.absPath)
+	if err != nil {
+		return false, err
+	}
+
+	if unit.desiredState == "masked" {
+		if isMasked {
+			return false, nil
+		}
+
+		s.logger.Info("masking unit", "unit", unit.unitName)
+		if err := stopUnit(unit.unitName); err != nil {
+			return false, err
+		}
+		// systemctl mask fails if the unit file is in /etc/systemd/system
+		if err := deleteFileIfExists(unit.absPath); err != nil {
+			return false, fmt.Errorf("failed to delete unit file: %w", err)
+		}
+		if output, err := execChroot("systemctl", "mask", unit.unitName); err != nil {
+			return false, fmt.Errorf("failed to mask %s: %s", unit.unitName, strings.TrimSpace(string(output)))
+		}
+		return true, nil
+	}
+
+	if isMasked {
+		s.logger.Info("unmasking unit", "unit", unit.unitName)
+		if output, err := execChroot("systemctl", "unmask", unit.unitName); err != nil {
+			return false, fmt.Errorf("failed to unmask %s: %s", unit.unitName, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if unit.fileContents == "" {
+		return false, fmt.Errorf("file of unit %s is empty", unit.unitName)
+	}
+
+	isFileEqual, err := checkFileContents(unit.absPath, unit.fileContents)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file contents: %w", err)
+	}
+	if isFileEqual {
+		return false, nil
+	}
+
+	if err := writeFile(unit.absPath, unit.fileContents); err != nil {
+		return false, fmt.Errorf("failed to write file: %w", err)
+	}
+	s.logger.Info("unit file updated", "unit", unit.unitName)
+
+	return true, nil
+}
+
+// reconcileUnit enables or disables the unit and starts, restarts or stops it
+// to reach its desired state
+func (s SystemdUnitConfig) reconcileUnit(unit systemdUnit, restart bool) error {
+	if enable, ok := unit.shouldEnable(); ok {
+		_, err := execChroot("systemctl", "is-enabled", "--quiet", unit.unitName)
+		isEnabled := err == nil
+
+		action := ""
+		if enable && !isEnabled {
+			action = "enable"
+		} else if !enable && isEnabled {
+			action = "disable"
+		}
+		if action != "" {
+			if output, err := execChroot("systemctl", action, unit.unitName); err != nil {
+				return fmt.Errorf("failed to %s %s: %s", action, unit.unitName, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+
+	_, err := execChroot("systemctl", "is-active", "--quiet", unit.unitName)
+	isActive := err == nil
+
+	if unit.desiredState == "stopped" {
+		if isActive {
+			s.logger.Info("stopping unit", "unit", unit.unitName)
+			return stopUnit(unit.unitName)
+		}
+		return nil
+	}
+
+	action := ""
+	if isActive && restart {
+		action = "restart"
+	} else if !isActive && !unit.triggered {
+		// triggered services are started by their timer, socket or path unit
+		action = "start"
+	}
+	if action == "" {
+		return nil
+	}
+
+	s.logger.Info("starting unit", "unit", unit.unitName, "action", action)
+	if output, err := execChroot("systemctl", action, unit.unitName); err != nil {
+		return fmt.Errorf("failed to %s %s: %s", action, unit.unitName, strings.TrimSpace(string(output)))
+	}
+
+	return waitForUnit(unit.unitName, s.readinessTimeout)
+}
+
+// waitForUnit waits until the unit is active, or has finished successfully
+// for oneshot services, until the timeout expires
+func waitForUnit(unitName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := execChroot("systemctl", "show", "-p", "ActiveState,SubState,Result", unitName)
 		if err != nil {
-			return fmt.Errorf("failed to start systemd service: %w", err)
+			return fmt.Errorf("failed to get state of %s: %s", unitName, strings.TrimSpace(string(output)))
 		}
 
-		isActive, err := checkIfServiceIsActive(unit.serviceName)
+		ready, err := unitReadiness(string(output))
 		if err != nil {
-			return err
+			return fmt.Errorf("unit %s is not ready: %w", unitName, err)
+		}
+		if ready {
+			return nil
 		}
 
-		if !isActive {
-			return fmt.Errorf("failed to activate service %s: %w", unit.serviceName, err)
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for unit %s to be ready", unitName)
 		}
+		time.Sleep(time.Second)
 	}
-	return nil
 }
 
-func (s SystemdUnitConfig) removeModule() error {
+// unitReadiness returns true if a unit is ready from its ActiveState,
+// SubState and Result properties. An error is returned if the unit failed
+func unitReadiness(properties string) (bool, error) {
+	values := map[string]string{}
+	for _, line := range strings.Split(properties, "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if found {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	switch values["ActiveState"] {
+	case "active":
+		return true, nil
+	case "failed":
+		return false, fmt.Errorf("unit failed with result %s", values["Result"])
+	case "inactive":
+		// oneshot services without RemainAfterExit are inactive after
+		// finishing successfully
+		if values["Result"] == "success" && values["SubState"] == "dead" {
+			return true, nil
+		}
+		if values["Result"] != "success" && values["Result"] != "" {
+			return false, fmt.Errorf("unit failed with result %s", values["Result"])
+		}
+	}
+
+	return false, nil
+}
+
+// recordTimers reports when the timers will elapse next
+func (s SystemdUnitConfig) recordTimers() {
 	for _, unit := range s.units {
-		_, err := execChroot("systemctl", "stop", unit.serviceName)
-		var ee *exec.ExitError
-		if errors.As(err, &ee) {
-			// exit code 5 from "systemd stop service" means
-			// that the service is not present in the system
-			if ee.ExitCode() != 5 {
-				return fmt.Errorf("failed to stop service: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to stop service: %w", err)
+		if unit.unitType != "timer" {
+			continue
 		}
 
-		err = os.Remove(unit.absPath)
+		output, err := execChroot("systemctl", "show",
+			"-p", "NextElapseUSecRealtime", "-p", "NextElapseUSecMonotonic", unit.unitName)
 		if err != nil {
-			if !errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("failed to delete service file: %w", err)
+			s.logger.Error(err, "failed to get timer status", "unit", unit.unitName)
+			continue
+		}
+
+		s.record(unit.unitName, timerStatusMessage(string(output)))
+	}
+}
+
+// timerStatusMessage returns the next elapse time from the properties of a
+// timer. Monotonic timers (e.g. OnBootSec) only have a time relative to the
+// boot
+func timerStatusMessage(properties string) string {
+	values := map[string]string{}
+	for _, line := range strings.Split(properties, "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if found {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	if next := values["NextElapseUSecRealtime"]; next != "" && next != "n/a" {
+		return "next elapse: " + next
+	}
+	if next := values["NextElapseUSecMonotonic"]; next != "" && next != "n/a" && next != "infinity" {
+		return "next elapse: " + next + " after boot"
+	}
+	return "no elapse scheduled"
+}
+
+func (s SystemdUnitConfig) removeModule() error {
+	// Activators are stopped first, so they don't start the units they
+	// trigger again
+	for _, activators := range []bool{true, false} {
+		for _, unit := range s.units {
+			if unit.isActivator() != activators {
+				continue
+			}
+
+			if err := s.removeUnit(unit); err != nil {
+				return err
 			}
 		}
 	}
@@ -188,26 +530,113 @@ func (s SystemdUnitConfig) removeModule() error {
 	return nil
 }
 
-func (s SystemdUnitConfig) checkCurrentConfig() (bool, error) {
-	for _, unit := range s.units {
-		isFileEqual, err := checkFileContents(unit.absPath, unit.fileContents)
-		if err != nil {
-			return false, fmt.Errorf("failed to check file contents: %w", err)
+func (s SystemdUnitConfig) removeUnit(unit systemdUnit) error {
+	isOwned, err := s.isUnitOwned(unit)
+	if err != nil {
+		return err
+	}
+	if !isOwned {
+		s.logger.Info("keeping unit file not managed by this NodeConfig", "unit", unit.unitName)
+		return nil
+	}
+
+	isMasked, err := isUnitMasked(unit.absPath)
+	if err != nil {
+		return err
+	}
+	if isMasked {
+		if output, err := execChroot("systemctl", "unmask", unit.unitName); err != nil {
+			return fmt.Errorf("failed to unmask %s: %s", unit.unitName, strings.TrimSpace(string(output)))
 		}
+		return nil
+	}
 
-		if !isFileEqual {
-			return false, nil
+	exists, err := checkFileExists(unit.absPath)
+	if err != nil {
+		return fmt.Errorf("failed to check unit file: %w", err)
+	}
+	if exists {
+		if _, err := execChroot("systemctl", "is-enabled", "--quiet", unit.unitName); err == nil {
+			output, err := execChroot("systemctl", "disable", unit.unitName)
+			if err != nil {
+				return fmt.Errorf("failed to disable %s: %s", unit.unitName, strings.TrimSpace(string(output)))
+			}
 		}
+	}
 
-		isActive, err := checkIfServiceIsActive(unit.serviceName)
-		if err != nil {
-			return false, err
+	if err := stopUnit(unit.unitName); err != nil {
+		return err
+	}
+	if err := restartAction(unit).done(); err != nil {
+		return err
+	}
+
+	err = os.Remove(unit.absPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete unit file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isUnitOwned returns false for mount unit files that don't have the owner
+// marker of this NodeConfig, e.g. written by an administrator or the mounts
+// module. Other units have the nco- prefix, and masked units are links to
+// /dev/null
+func (s SystemdUnitConfig) isUnitOwned(unit systemdUnit) (bool, error) {
+	if unit.unitType != "mount" {
+		return true, nil
+	}
+
+	isMasked, err := isUnitMasked(unit.absPath)
+	if err != nil || isMasked {
+		return true, err
+	}
+
+	content, err := os.ReadFile(unit.absPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read unit file: %w", err)
+	}
+	return slices.Contains(strings.Split(string(content), "\n"), s.ownerMarker), nil
+}
+
+func stopUnit(unitName string) error {
+	_, err := execChroot("systemctl", "stop", unitName)
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		// exit code 5 from "systemd stop service" means
+		// that the service is not present in the system
+		if ee.ExitCode() != 5 {
+			return fmt.Errorf("failed to stop unit: %w", err)
 		}
+	} else if err != nil {
+		return fmt.Errorf("failed to stop unit: %w", err)
+	}
+
+	return nil
+}
 
-		if !isActive {
+// isUnitMasked checks if the unit file is a link to /dev/null
+func isUnitMasked(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			return false, nil
 		}
+		return false, fmt.Errorf("failed to check unit file: %w", err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return false, nil
 	}
 
-	return true, nil
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to check unit file: %w", err)
+	}
+	return target == "/dev/null", nil
 }
@@ -0,0 +1,126 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSystemdUnitName(t *testing.T) {
+	tests := []struct {
+		name, unitType             string
+		expectedName, expectedType string
+	}{
+		{"backup", "", "nco-backup", "service"},
+		{"backup.service", "", "nco-backup", "service"},
+		{"backup.timer", "", "nco-backup", "timer"},
+		{"backup", "timer", "nco-backup", "timer"},
+		{"backup.socket", "socket", "nco-backup", "socket"},
+		{"mnt-data", "mount", "mnt-data", "mount"},
+		{"mnt-data.mount", "", "mnt-data", "mount"},
+	}
+
+	for _, test := range tests {
+		name, unitType := systemdUnitName(test.name, test.unitType)
+		if name != test.expectedName || unitType != test.expectedType {
+			t.Errorf("systemdUnitName(%q, %q) = %q, %q", test.name, test.unitType, name, unitType)
+		}
+	}
+}
+
+func TestNewSystemdUnitConfigTriggered(t *testing.T) {
+	config := NewSystemdUnitConfig(SystemdUnits{
+		Units: []SystemdUnit{
+			{Name: "backup", Type: "service"},
+			{Name: "backup", Type: "timer"},
+			{Name: "web"},
+		},
+	}, logr.Discard(), "default-sample")
+
+	expected := map[string]bool{
+		"nco-backup.service": true,
+		"nco-backup.timer":   false,
+		"nco-web.service":    false,
+	}
+	for _, unit := range config.units {
+		if unit.triggered != expected[unit.unitName] {
+			t.Errorf("unexpected triggered value for %s: %v", unit.unitName, unit.triggered)
+		}
+	}
+}
+
+func TestTimerStatusMessage(t *testing.T) {
+	tests := map[string]string{
+		"NextElapseUSecRealtime=Mon 2026-10-19 00:00:00 UTC\nNextElapseUSecMonotonic=infinity\n": "next elapse: Mon 2026-10-19 00:00:00 UTC",
+		"NextElapseUSecRealtime=\nNextElapseUSecMonotonic=2h 5min\n":                             "next elapse: 2h 5min after boot",
+		"NextElapseUSecRealtime=n/a\nNextElapseUSecMonotonic=infinity\n":                         "no elapse scheduled",
+	}
+
+	for properties, expected := range tests {
+		if message := timerStatusMessage(properties); message != expected {
+			t.Errorf("timerStatusMessage(%q) = %q, expected %q", properties, message, expected)
+		}
+	}
+}
+
+func TestUnitReadiness(t *testing.T) {
+	tests := []struct {
+		properties string
+		ready      bool
+		fails      bool
+	}{
+		{"ActiveState=active\nSubState=running\nResult=success\n", true, false},
+		{"ActiveState=activating\nSubState=start\nResult=success\n", false, false},
+		{"ActiveState=inactive\nSubState=dead\nResult=success\n", true, false},
+		{"ActiveState=failed\nSubState=failed\nResult=exit-code\n", false, true},
+		{"ActiveState=inactive\nSubState=dead\nResult=timeout\n", false, true},
+	}
+
+	for _, test := range tests {
+		ready, err := unitReadiness(test.properties)
+		if ready != test.ready || (err != nil) != test.fails {
+			t.Errorf("unitReadiness(%q) = %v, %v", test.properties, ready, err)
+		}
+	}
+}
+
+func TestSystemdUnitOwnership(t *testing.T) {
+	config := NewSystemdUnitConfig(SystemdUnits{
+		Units: []SystemdUnit{
+			{Name: "mnt-data", Type: "mount", File: "[Mount]\nWhat=/dev/sdb\nWhere=/mnt/data\n"},
+		},
+	}, logr.Discard(), "default-sample")
+	unit := config.units[0]
+	unit.absPath = filepath.Join(t.TempDir(), unit.unitName)
+
+	expected := overrideHeader + "\n# NCO OWNER default-sample\n[Mount]\nWhat=/dev/sdb\nWhere=/mnt/data\n"
+	if unit.fileContents != expected {
+		t.Errorf("unexpected mount unit contents:\n%s", unit.fileContents)
+	}
+
+	tests := map[string]bool{
+		"":                                  true,
+		unit.fileContents:                   true,
+		overrideHeader + "\n[Mount]\n":      false,
+		"# NCO OWNER other-sample\n[Mount]": false,
+	}
+	for content, expected := range tests {
+		if content != "" {
+			if err := os.WriteFile(unit.absPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		isOwned, err := config.isUnitOwned(unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isOwned != expected {
+			t.Errorf("isUnitOwned for %q = %v, expected %v", content, isOwned, expected)
+		}
+		if err := deleteFileIfExists(unit.absPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
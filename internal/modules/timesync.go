@@ -0,0 +1,464 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	CHRONY_DAEMON    = "chrony"
+	TIMESYNCD_DAEMON = "timesyncd"
+)
+
+const (
+	timesyncdDropInPath = "/host/etc/systemd/timesyncd.conf.d"
+	zoneInfoPath        = "/usr/share/zoneinfo"
+)
+
+// +kubebuilder:object:generate=true
+// TimeSync defines the time synchronization and the timezone of the host
+type TimeSync struct {
+	// Daemon to configure. If not set, chrony is used when it's installed and
+	// systemd-timesyncd otherwise
+	// +kubebuilder:validation:Enum=chrony;timesyncd
+	// +optional
+	Daemon string `json:"daemon,omitempty"`
+	// NTP servers
+	Servers []string `json:"servers,omitempty"`
+	// NTP pools. systemd-timesyncd uses them as servers
+	Pools []string `json:"pools,omitempty"`
+	// Step the clock if its offset is larger than the threshold, only used by
+	// chrony
+	// +optional
+	MakeStep *TimeSyncMakeStep `json:"makeStep,omitempty"`
+	// Timezone of the host (e.g. UTC or America/Santiago)
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (t TimeSync) IsPresent() bool {
+	isEmpty := len(t.Servers) == 0 && len(t.Pools) == 0 && t.Timezone == ""
+	if !isEmpty && t.State == "present" {
+		return true
+	}
+	return false
+}
+
+type TimeSyncMakeStep struct {
+	// Offset in seconds above which the clock is stepped (e.g. "1.0")
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	Threshold string `json:"threshold"`
+	// Number of clock updates in which the clock can be stepped, -1 for
+	// no limit
+	// +kubebuilder:validation:Minimum:=-1
+	Limit int `json:"limit"`
+}
+
+type TimeSyncConfig struct {
+	TimeSync
+	*statusRecorder
+	logger      logr.Logger
+	dropInPath  string
+	beginMarker string
+	endMarker   string
+}
+
+func NewTimeSyncConfig(timeSync TimeSync, logger logr.Logger, name string) TimeSyncConfig {
+	return TimeSyncConfig{
+		TimeSync:       timeSync,
+		statusRecorder: newStatusRecorder("timeSync"),
+		logger:         logger,
+		dropInPath:     fmt.Sprintf("%s/50-nco-%s.conf", timesyncdDropInPath, name),
+		beginMarker:    fmt.Sprintf("# BEGIN MARKER NCO TIMESYNC %s", name),
+		endMarker:      fmt.Sprintf("# END MARKER NCO TIMESYNC %s", name),
+	}
+}
+
+func (t TimeSyncConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		t.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"timeSync", nil}
+	if t.State == "present" {
+		t.logger.V(1).Info("applying module")
+		if err := t.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		t.logger.V(1).Info("module applied")
+	} else if t.State == "absent" {
+		t.logger.V(1).Info("removing module")
+		if err := t.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		t.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (t TimeSyncConfig) applyModule() error {
+	if t.Timezone != "" {
+		if err := t.applyTimezone(); err != nil {
+			return err
+		}
+	}
+
+	if len(t.Servers) == 0 && len(t.Pools) == 0 {
+		return nil
+	}
+
+	daemon, err := t.daemon()
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	if daemon == CHRONY_DAEMON {
+		changed, err = t.applyChrony()
+	} else {
+		changed, err = t.applyTimesyncd()
+	}
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		if err := t.restartAction(daemon).mark(); err != nil {
+			return err
+		}
+	}
+	if err := t.restartDaemon(daemon); err != nil {
+		return err
+	}
+
+	t.recordSyncStatus(daemon)
+	return nil
+}
+
+func (t TimeSyncConfig) removeModule() error {
+	daemon, err := t.daemon()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	if daemon == CHRONY_DAEMON {
+		configPath, err := chronyConfigPath()
+		if err != nil {
+			return err
+		}
+
+		previousHash, err := fileSHA256(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to hash chrony config: %w", err)
+		}
+		if previousHash != "" {
+			if err := deleteBlockFromFile(configPath, []byte(t.beginMarker), []byte(t.endMarker)); err != nil {
+				return fmt.Errorf("failed to remove chrony config: %w", err)
+			}
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to read chrony config: %w", err)
+			}
+			if restored, ok := uncommentDisabledLines(string(content)); ok {
+				if err := writeFile(configPath, restored); err != nil {
+					return fmt.Errorf("failed to write chrony config: %w", err)
+				}
+			}
+
+			currentHash, err := fileSHA256(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to hash chrony config: %w", err)
+			}
+			changed = currentHash != previousHash
+		}
+	} else {
+		exists, err := checkFileExists(t.dropInPath)
+		if err != nil {
+			return fmt.Errorf("failed to check timesyncd config: %w", err)
+		}
+		if exists {
+			if err := deleteFileIfExists(t.dropInPath); err != nil {
+				return fmt.Errorf("failed to delete timesyncd config: %w", err)
+			}
+			changed = true
+		}
+	}
+
+	// The timezone is kept, as there's no previous value to restore
+	if changed {
+		if err := t.restartAction(daemon).mark(); err != nil {
+			return err
+		}
+	}
+	return t.restartDaemon(daemon)
+}
+
+// daemon returns the daemon set in the spec or detects the installed one
+func (t TimeSyncConfig) daemon() (string, error) {
+	if t.Daemon != "" {
+		return t.Daemon, nil
+	}
+
+	isChrony, err := checkFileExists("/host/usr/sbin/chronyd")
+	if err != nil {
+		return "", fmt.Errorf("failed to detect time sync daemon: %w", err)
+	}
+	if isChrony {
+		return CHRONY_DAEMON, nil
+	}
+	return TIMESYNCD_DAEMON, nil
+}
+
+// applyChrony writes the sources to a block in chrony.conf and comments the
+// sources defined outside the block
+func (t TimeSyncConfig) applyChrony() (bool, error) {
+	configPath, err := chronyConfigPath()
+	if err != nil {
+		return false, err
+	}
+
+	previousHash, err := fileSHA256(configPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash chrony config: %w", err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to read chrony config: %w", err)
+	}
+	if commented, ok := commentChronySources(string(content), t.beginMarker, t.endMarker, t.MakeStep != nil); ok {
+		if err := writeFile(configPath, commented); err != nil {
+			return false, fmt.Errorf("failed to write chrony config: %w", err)
+		}
+	}
+
+	block := chronyBlock(t.TimeSync)
+	if err := writeBlockToFile(configPath, []byte(t.beginMarker), []byte(t.endMarker), []byte(block)); err != nil {
+		return false, fmt.Errorf("failed to write chrony config: %w", err)
+	}
+
+	currentHash, err := fileSHA256(configPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash chrony config: %w", err)
+	}
+
+	return currentHash != previousHash, nil
+}
+
+// applyTimesyncd writes a timesyncd.conf drop-in with the servers
+func (t TimeSyncConfig) applyTimesyncd() (bool, error) {
+	if t.MakeStep != nil {
+		t.logger.Info("makeStep is only supported by chrony, ignoring it")
+	}
+
+	servers := append(append([]string{}, t.Servers...), t.Pools...)
+	content := fmt.Sprintf("%s\n[Time]\nNTP=%s\n", overrideHeader, strings.Join(servers, " "))
+
+	isCurrent, err := checkFileContents(t.dropInPath, content)
+	if err != nil {
+		return false, fmt.Errorf("failed to check timesyncd config: %w", err)
+	}
+	if isCurrent {
+		return false, nil
+	}
+
+	if err := writeFile(t.dropInPath, content); err != nil {
+		return false, fmt.Errorf("failed to write timesyncd config: %w", err)
+	}
+	return true, nil
+}
+
+// restartAction is recorded when the configuration of the daemon changes and
+// cleared once it's restarted, so a failed restart is retried in the next
+// reconciliations
+func (t TimeSyncConfig) restartAction(daemon string) pendingAction {
+	return newPendingAction("timeSync", daemon)
+}
+
+func (t TimeSyncConfig) restartDaemon(daemon string) error {
+	pending := t.restartAction(daemon)
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	service := "chronyd"
+	if daemon == TIMESYNCD_DAEMON {
+		service = "systemd-timesyncd"
+	}
+
+	t.logger.Info("restarting time sync service", "service", service)
+	if output, err := execChroot("systemctl", "restart", service); err != nil {
+		return fmt.Errorf("failed to restart %s: %s", service, strings.TrimSpace(string(output)))
+	}
+
+	isActive, err := checkIfServiceIsActive(service)
+	if err != nil {
+		return err
+	}
+	if !isActive {
+		return fmt.Errorf("service %s is not active", service)
+	}
+
+	return pending.done()
+}
+
+// applyTimezone sets the timezone with timedatectl if /etc/localtime doesn't
+// point to it
+func (t TimeSyncConfig) applyTimezone() error {
+	zoneFile := filepath.Join(zoneInfoPath, t.Timezone)
+	if filepath.Clean(zoneFile) != zoneFile || !strings.HasPrefix(zoneFile, zoneInfoPath+"/") {
+		return fmt.Errorf("invalid timezone %s", t.Timezone)
+	}
+
+	exists, err := checkFileExists("/host" + zoneFile)
+	if err != nil {
+		return fmt.Errorf("failed to check timezone: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("timezone %s is not installed", t.Timezone)
+	}
+
+	target, err := os.Readlink("/host/etc/localtime")
+	if err == nil && strings.HasSuffix(target, "zoneinfo/"+t.Timezone) {
+		return nil
+	}
+
+	t.logger.Info("setting timezone", "timezone", t.Timezone)
+	output, err := execHostNamespace("timedatectl", "set-timezone", t.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to set timezone: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// recordSyncStatus reports the synchronization status of the daemon
+func (t TimeSyncConfig) recordSyncStatus(daemon string) {
+	if daemon == CHRONY_DAEMON {
+		output, err := execHostNamespace("chronyc", "tracking")
+		if err != nil {
+			t.record(daemon, fmt.Sprintf("failed to get tracking: %s", strings.TrimSpace(string(output))))
+			return
+		}
+
+		tracking := parseColonFields(string(output))
+		t.record(daemon, fmt.Sprintf("reference=%s systemTime=%s leapStatus=%s",
+			tracking["Reference ID"], tracking["System time"], tracking["Leap status"]))
+		return
+	}
+
+	output, err := execHostNamespace("timedatectl", "show-timesync")
+	if err != nil {
+		t.record(daemon, fmt.Sprintf("failed to get sync status: %s", strings.TrimSpace(string(output))))
+		return
+	}
+
+	status := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			status[key] = value
+		}
+	}
+	t.record(daemon, fmt.Sprintf("server=%s address=%s", status["ServerName"], status["ServerAddress"]))
+}
+
+// chronyConfigPath returns the path used by Debian based hosts if it exists,
+// or the one used by RHEL based hosts
+func chronyConfigPath() (string, error) {
+	debianPath := "/host/etc/chrony/chrony.conf"
+	exists, err := checkFileExists(debianPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to check chrony config: %w", err)
+	}
+	if exists {
+		return debianPath, nil
+	}
+	return "/host/etc/chrony.conf", nil
+}
+
+func chronyBlock(timeSync TimeSync) string {
+	lines := []string{}
+	for _, server := range timeSync.Servers {
+		lines = append(lines, fmt.Sprintf("server %s iburst", server))
+	}
+	for _, pool := range timeSync.Pools {
+		lines = append(lines, fmt.Sprintf("pool %s iburst", pool))
+	}
+	if timeSync.MakeStep != nil {
+		lines = append(lines, fmt.Sprintf("makestep %s %d", timeSync.MakeStep.Threshold, timeSync.MakeStep.Limit))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// commentChronySources comments the server, pool and peer directives outside
+// the operator's block. makestep is only commented if the block has its own,
+// otherwise the one commented before is restored
+func commentChronySources(content, beginMarker, endMarker string, makeStep bool) (string, bool) {
+	changed := false
+	insideBlock := false
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if line == beginMarker {
+			insideBlock = true
+			continue
+		} else if line == endMarker {
+			insideBlock = false
+			continue
+		}
+
+		if insideBlock {
+			continue
+		}
+		if !makeStep && strings.HasPrefix(line, disabledLinePrefix+"makestep") {
+			lines[i] = strings.TrimPrefix(line, disabledLinePrefix)
+			changed = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "server", "pool", "peer":
+			lines[i] = disabledLinePrefix + line
+			changed = true
+		case "makestep":
+			if makeStep {
+				lines[i] = disabledLinePrefix + line
+				changed = true
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n"), changed
+}
+
+// parseColonFields parses "key : value" lines, as printed by chronyc
+func parseColonFields(output string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,73 @@
+package modules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommentChronySources(t *testing.T) {
+	content := `pool 2.debian.pool.ntp.org iburst
+sourcedir /run/chrony-dhcp
+# server old.example.com
+makestep 1 3
+# BEGIN MARKER NCO TIMESYNC test
+server ntp1.example.com iburst
+# END MARKER NCO TIMESYNC test
+`
+	commented, changed := commentChronySources(content, "# BEGIN MARKER NCO TIMESYNC test", "# END MARKER NCO TIMESYNC test", true)
+	if !changed {
+		t.Fatal("expected content to change")
+	}
+
+	expected := `#NCO-DISABLED# pool 2.debian.pool.ntp.org iburst
+sourcedir /run/chrony-dhcp
+# server old.example.com
+#NCO-DISABLED# makestep 1 3
+# BEGIN MARKER NCO TIMESYNC test
+server ntp1.example.com iburst
+# END MARKER NCO TIMESYNC test
+`
+	if commented != expected {
+		t.Errorf("unexpected content:\n%s", commented)
+	}
+
+	restored, _ := uncommentDisabledLines(commented)
+	if restored != content {
+		t.Errorf("unexpected restored content:\n%s", restored)
+	}
+
+	// Without makeStep, the makestep of the host is kept or restored
+	withoutMakeStep, _ := commentChronySources(commented, "# BEGIN MARKER NCO TIMESYNC test", "# END MARKER NCO TIMESYNC test", false)
+	expected = strings.Replace(expected, "#NCO-DISABLED# makestep", "makestep", 1)
+	if withoutMakeStep != expected {
+		t.Errorf("unexpected content without makeStep:\n%s", withoutMakeStep)
+	}
+}
+
+func TestChronyBlock(t *testing.T) {
+	block := chronyBlock(TimeSync{
+		Servers:  []string{"ntp1.example.com"},
+		Pools:    []string{"pool.ntp.org"},
+		MakeStep: &TimeSyncMakeStep{Threshold: "1.0", Limit: 3},
+	})
+
+	expected := "server ntp1.example.com iburst\npool pool.ntp.org iburst\nmakestep 1.0 3"
+	if block != expected {
+		t.Errorf("unexpected block:\n%s", block)
+	}
+}
+
+func TestParseColonFields(t *testing.T) {
+	output := `Reference ID    : C0A80101 (ntp1.example.com)
+Stratum         : 3
+System time     : 0.000012345 seconds fast of NTP time
+Leap status     : Normal
+`
+	fields := parseColonFields(output)
+	if fields["Reference ID"] != "C0A80101 (ntp1.example.com)" {
+		t.Errorf("unexpected reference: %q", fields["Reference ID"])
+	}
+	if fields["Leap status"] != "Normal" {
+		t.Errorf("unexpected leap status: %q", fields["Leap status"])
+	}
+}
@@ -0,0 +1,281 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const udevRulesPath = "/etc/udev/rules.d"
+
+// +kubebuilder:object:generate=true
+// UdevRules defines the rules to install in /etc/udev/rules.d
+type UdevRules struct {
+	Rules []UdevRule `json:"rules,omitempty"`
+	// +kubebuilder:validation:Enum="present";"absent"
+	State string `json:"state,omitempty"`
+	// Priority to set for these rules (default: 50)
+	// +kubebuilder:validation:Maximum:=99
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=50
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+}
+
+// IsPresent method checks if the module is present
+func (u UdevRules) IsPresent() bool {
+	if len(u.Rules) != 0 && u.State == "present" {
+		return true
+	}
+	return false
+}
+
+// +kubebuilder:object:generate=true
+type UdevRule struct {
+	// Name of the rule. The file is named <priority>-nco-<NodeConfig>-<name>.rules
+	Name string `json:"name"`
+	// Contents of the rules file
+	Content string `json:"content"`
+	// Devices to trigger when the rule changes. If not set, the rules are only
+	// reloaded and apply to new events
+	// +optional
+	Trigger *UdevTrigger `json:"trigger,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type UdevTrigger struct {
+	// Subsystems of the devices to trigger (e.g. net, block)
+	// +kubebuilder:validation:MinItems:=1
+	Subsystems []string `json:"subsystems"`
+	// Action of the triggered events
+	// +kubebuilder:validation:Enum=add;change
+	// +kubebuilder:default:=change
+	Action string `json:"action,omitempty"`
+}
+
+type UdevRulesConfig struct {
+	UdevRules
+	*statusRecorder
+	logger       logr.Logger
+	resourceName string
+}
+
+func NewUdevRulesConfig(rules UdevRules, logger logr.Logger, name string) UdevRulesConfig {
+	return UdevRulesConfig{
+		UdevRules:      rules,
+		statusRecorder: newStatusRecorder("udevRules"),
+		logger:         logger,
+		resourceName:   name,
+	}
+}
+
+func (u UdevRulesConfig) Reconcile() error {
+	hostFsEnabled := os.Getenv("HOSTFS_ENABLED")
+	if hostFsEnabled != "true" {
+		err := errors.New("HOSTFS_ENABLED is set to false")
+		u.logger.Error(err, "module needs the host's filesystem to work, set HOSTFS_ENABLED to true")
+		return nil
+	}
+
+	moduleError := ModuleError{"udevRules", nil}
+	if u.State == "present" {
+		u.logger.V(1).Info("applying module")
+		if err := u.applyModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		u.logger.V(1).Info("module applied")
+	} else if u.State == "absent" {
+		u.logger.V(1).Info("removing module")
+		if err := u.removeModule(); err != nil {
+			moduleError.error = err
+			return moduleError
+		}
+		u.logger.V(1).Info("module removed")
+	}
+
+	return nil
+}
+
+func (u UdevRulesConfig) applyModule() error {
+	canVerify := u.canVerify()
+	if !canVerify {
+		u.logger.V(1).Info("udevadm verify is not available, rules won't be validated")
+	}
+
+	failed := []string{}
+	for _, rule := range u.Rules {
+		isChanged, err := u.installRule(rule, canVerify)
+		if err != nil {
+			u.logger.Error(err, "failed to install rule", "name", rule.Name)
+			u.record(rule.Name, err.Error())
+			failed = append(failed, rule.Name)
+			continue
+		}
+		if isChanged {
+			if err := u.reloadAction().mark(); err != nil {
+				return err
+			}
+			if err := u.triggerAction(rule).mark(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := u.reloadRules(); err != nil {
+		return err
+	}
+	for _, rule := range u.Rules {
+		if err := u.triggerRule(rule); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("failed to install rules: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func (u UdevRulesConfig) removeModule() error {
+	for _, rule := range u.Rules {
+		filePath := "/host" + u.filePath(rule)
+		exists, err := checkFileExists(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to check rule %s: %w", rule.Name, err)
+		}
+		if !exists {
+			continue
+		}
+
+		if err := deleteFileIfExists(filePath); err != nil {
+			return fmt.Errorf("failed to delete rule %s: %w", rule.Name, err)
+		}
+		if err := u.reloadAction().mark(); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range u.Rules {
+		if err := u.triggerAction(rule).done(); err != nil {
+			return err
+		}
+	}
+
+	return u.reloadRules()
+}
+
+// installRule writes the rule to a temporary file, validates it and renames it
+// to its final path. udev only reads files with the .rules suffix, so the
+// temporary file is never loaded
+func (u UdevRulesConfig) installRule(rule UdevRule, canVerify bool) (bool, error) {
+	filePath := u.filePath(rule)
+	content := strings.TrimRight(rule.Content, "\n") + "\n"
+
+	isCurrent, err := checkFileContents("/host"+filePath, content)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file contents: %w", err)
+	}
+	if isCurrent {
+		return false, nil
+	}
+
+	tmpPath := fmt.Sprintf("%s/.%s.tmp", udevRulesPath, u.fileName(rule))
+	if err := writeFile("/host"+tmpPath, content); err != nil {
+		return false, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	defer func() {
+		_ = deleteFileIfExists("/host" + tmpPath)
+	}()
+
+	if canVerify {
+		output, err := execHostNamespace("udevadm", "verify", tmpPath)
+		if err != nil {
+			return false, fmt.Errorf("validation failed: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	if err := os.Rename("/host"+tmpPath, "/host"+filePath); err != nil {
+		return false, fmt.Errorf("failed to install file: %w", err)
+	}
+
+	u.logger.Info("udev rule installed", "path", filePath)
+	return true, nil
+}
+
+// canVerify checks if udevadm supports the verify command, added in
+// systemd 254
+func (u UdevRulesConfig) canVerify() bool {
+	_, err := execHostNamespace("udevadm", "verify", "--help")
+	return err == nil
+}
+
+// reloadAction and triggerAction are recorded when a rule changes and cleared
+// once udevadm succeeds, so a failed reload or trigger is retried in the next
+// reconciliations
+func (u UdevRulesConfig) reloadAction() pendingAction {
+	return newPendingAction("udevRules", "reload "+u.resourceName)
+}
+
+func (u UdevRulesConfig) triggerAction(rule UdevRule) pendingAction {
+	return newPendingAction("udevRules", u.filePath(rule))
+}
+
+func (u UdevRulesConfig) reloadRules() error {
+	pending := u.reloadAction()
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	output, err := execHostNamespace("udevadm", "control", "--reload")
+	if err != nil {
+		return fmt.Errorf("failed to reload udev rules: %s", strings.TrimSpace(string(output)))
+	}
+	return pending.done()
+}
+
+func (u UdevRulesConfig) triggerRule(rule UdevRule) error {
+	pending := u.triggerAction(rule)
+	isPending, err := pending.isPending()
+	if err != nil || !isPending {
+		return err
+	}
+
+	if rule.Trigger != nil {
+		args := udevTriggerArgs(*rule.Trigger)
+		u.logger.Info("triggering udev events", "rule", rule.Name, "args", args)
+		output, err := execHostNamespace(args...)
+		if err != nil {
+			return fmt.Errorf("failed to trigger udev events for %s: %s", rule.Name, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return pending.done()
+}
+
+func (u UdevRulesConfig) fileName(rule UdevRule) string {
+	return fmt.Sprintf("%d-nco-%s-%s", *u.Priority, u.resourceName, sanitizeFileName(rule.Name))
+}
+
+func (u UdevRulesConfig) filePath(rule UdevRule) string {
+	return fmt.Sprintf("%s/%s.rules", udevRulesPath, u.fileName(rule))
+}
+
+func udevTriggerArgs(trigger UdevTrigger) []string {
+	action := trigger.Action
+	if action == "" {
+		action = "change"
+	}
+
+	args := []string{"udevadm", "trigger", "--action=" + action}
+	for _, subsystem := range trigger.Subsystems {
+		args = append(args, "--subsystem-match="+subsystem)
+	}
+
+	return args
+}
@@ -0,0 +1,20 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUdevTriggerArgs(t *testing.T) {
+	args := udevTriggerArgs(UdevTrigger{Subsystems: []string{"net", "block"}})
+	expected := []string{"udevadm", "trigger", "--action=change", "--subsystem-match=net", "--subsystem-match=block"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	args = udevTriggerArgs(UdevTrigger{Action: "add"})
+	expected = []string{"udevadm", "trigger", "--action=add"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
@@ -3,6 +3,8 @@ package modules
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +12,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +22,71 @@ type Config interface {
 	Reconcile() error
 }
 
+// Interface that modules implement when they report information about the
+// items they manage in the node's status
+type StatusReporter interface {
+	Status() []ModuleStatus
+}
+
+// ModuleStatus is a message reported by a module about one of its items
+type ModuleStatus struct {
+	// Module that reported the message
+	Module string `json:"module"`
+	// Item of the module the message refers to (e.g. a file name)
+	Name string `json:"name,omitempty"`
+	// Message reported by the module
+	Message string `json:"message"`
+	// The change only takes effect after the node is rebooted
+	RebootRequired bool `json:"rebootRequired,omitempty"`
+	// The message needs the attention of an administrator, a Warning event
+	// is also emitted
+	Warning bool `json:"warning,omitempty"`
+}
+
+// statusRecorder collects the messages of a module during its reconciliation.
+// Configs keep a pointer to it so all copies of a config share the messages
+type statusRecorder struct {
+	module   string
+	statuses []ModuleStatus
+}
+
+func newStatusRecorder(module string) *statusRecorder {
+	return &statusRecorder{module: module}
+}
+
+func (r *statusRecorder) record(name, message string) {
+	r.statuses = append(r.statuses, ModuleStatus{
+		Module:  r.module,
+		Name:    name,
+		Message: message,
+	})
+}
+
+// recordRebootRequired reports a change that needs a reboot to take effect
+func (r *statusRecorder) recordRebootRequired(name, message string) {
+	r.statuses = append(r.statuses, ModuleStatus{
+		Module:         r.module,
+		Name:           name,
+		Message:        message,
+		RebootRequired: true,
+	})
+}
+
+// recordWarning reports a problem that needs the attention of an
+// administrator
+func (r *statusRecorder) recordWarning(name, message string) {
+	r.statuses = append(r.statuses, ModuleStatus{
+		Module:  r.module,
+		Name:    name,
+		Message: message,
+		Warning: true,
+	})
+}
+
+func (r *statusRecorder) Status() []ModuleStatus {
+	return r.statuses
+}
+
 type ModuleError struct {
 	moduleName string
 	error      error
@@ -248,6 +317,15 @@ func execChroot(args ...string) ([]byte, error) {
 	return cmd.CombinedOutput()
 }
 
+// execHostNamespace runs a command in the mount namespace of the host's init
+// process. Commands like mount need it, as a chroot would change the pod's
+// mounts instead of the host's
+func execHostNamespace(args ...string) ([]byte, error) {
+	cmdArgs := append([]string{"--target", "1", "--mount", "--"}, args...)
+	cmd := exec.Command("nsenter", cmdArgs...)
+	return cmd.CombinedOutput()
+}
+
 // sanitizeFileName converts the name to lowercase and replaces spaces with underscores.
 func sanitizeFileName(name string) string {
 	sanitized := strings.ToLower(name)
@@ -274,6 +352,28 @@ func checkIfServiceIsActive(serviceName string) (bool, error) {
 	return true, nil
 }
 
+// ownedFiles returns the files matching the pattern that have the owner
+// marker line of a NodeConfig
+func ownedFiles(pattern, ownerMarker string) ([]string, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := []string{}
+	for _, fileName := range files {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fileName, err)
+		}
+		if slices.Contains(strings.Split(string(content), "\n"), ownerMarker) {
+			owned = append(owned, fileName)
+		}
+	}
+
+	return owned, nil
+}
+
 // Helper function to check if a file exists.
 func checkFileExists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -293,3 +393,202 @@ func deleteFileIfExists(path string) error {
 	}
 	return nil
 }
+
+// SecretKeyRef selects a key of a Secret in the same namespace as the
+// NodeConfig
+type SecretKeyRef struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Key of the secret to select
+	Key string `json:"key"`
+}
+
+// SecretReader returns the value of the key referenced by ref. It's
+// implemented by the controller so modules don't need a kubernetes client
+type SecretReader func(ref SecretKeyRef) (string, error)
+
+type hostUser struct {
+	name string
+	uid  int
+	gid  int
+	home string
+}
+
+// lookupHostUser finds a user in the host's /etc/passwd file
+func lookupHostUser(name string) (hostUser, error) {
+	content, err := os.ReadFile("/host/etc/passwd")
+	if err != nil {
+		return hostUser{}, fmt.Errorf("failed to read passwd file: %w", err)
+	}
+
+	return findPasswdUser(string(content), name)
+}
+
+func findPasswdUser(passwd string, name string) (hostUser, error) {
+	for _, line := range strings.Split(passwd, "\n") {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 || fields[0] != name {
+			continue
+		}
+
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return hostUser{}, fmt.Errorf("invalid uid for user %s: %w", name, err)
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return hostUser{}, fmt.Errorf("invalid gid for user %s: %w", name, err)
+		}
+
+		return hostUser{
+			name: name,
+			uid:  uid,
+			gid:  gid,
+			home: fields[5],
+		}, nil
+	}
+
+	return hostUser{}, fmt.Errorf("user %s not found", name)
+}
+
+// lookupHostGroup finds the gid of a group in the host's /etc/group file
+func lookupHostGroup(name string) (int, error) {
+	content, err := os.ReadFile("/host/etc/group")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read group file: %w", err)
+	}
+
+	return findGroupID(string(content), name)
+}
+
+func findGroupID(group string, name string) (int, error) {
+	for _, line := range strings.Split(group, "\n") {
+		// name:password:gid:members
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] != name {
+			continue
+		}
+
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid gid for group %s: %w", name, err)
+		}
+		return gid, nil
+	}
+
+	return 0, fmt.Errorf("group %s not found", name)
+}
+
+// fileSHA256 returns the sha256 hash of the file's contents, or an empty
+// string if the file doesn't exist
+func fileSHA256(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return contentSHA256(string(content)), nil
+}
+
+func contentSHA256(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes the content to a temporary file in the same
+// directory and renames it to path, so readers never see a partial file
+func writeFileAtomic(path string, content string, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".nco-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = deleteFileIfExists(tmpFile.Name())
+	}()
+
+	if _, err := tmpFile.WriteString(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpFile.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// Prefix used to comment lines in files not owned by the operator, like the
+// swap entries in /etc/fstab or the NTP sources of chrony, so they can be
+// restored when the module is removed
+const disabledLinePrefix = "#NCO-DISABLED# "
+
+// uncommentDisabledLines restores the lines commented with disabledLinePrefix
+func uncommentDisabledLines(content string) (string, bool) {
+	changed := false
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, disabledLinePrefix) {
+			lines[i] = strings.TrimPrefix(line, disabledLinePrefix)
+			changed = true
+		}
+	}
+
+	return strings.Join(lines, "\n"), changed
+}
+
+// pendingActionsPath keeps the markers of the actions that must run after a
+// change in the host
+const pendingActionsPath = "/host/etc/nco/pending"
+
+// pendingAction is an action, like restarting a service, that must run after
+// a change in the host. Its marker is written when the change is done and
+// deleted once the action succeeds, so a failed action is retried in the next
+// reconciliations, even if the operator restarted in between
+type pendingAction struct {
+	key  string
+	path string
+}
+
+// newPendingAction returns the action of a module for the key, e.g. the path
+// of the changed file
+func newPendingAction(module, key string) pendingAction {
+	return pendingAction{
+		key:  key,
+		path: fmt.Sprintf("%s/%s-%s", pendingActionsPath, module, contentSHA256(key)[:16]),
+	}
+}
+
+func (a pendingAction) mark() error {
+	if err := writeFile(a.path, a.key+"\n"); err != nil {
+		return fmt.Errorf("failed to record pending action for %s: %w", a.key, err)
+	}
+	return nil
+}
+
+func (a pendingAction) isPending() (bool, error) {
+	exists, err := checkFileExists(a.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to check pending action for %s: %w", a.key, err)
+	}
+	return exists, nil
+}
+
+func (a pendingAction) done() error {
+	if err := deleteFileIfExists(a.path); err != nil {
+		return fmt.Errorf("failed to clear pending action for %s: %w", a.key, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -100,3 +101,65 @@ line1`
 		t.Errorf("expected:\n%s\n\nactual:\n%s", expected, out)
 	}
 }
+
+func TestFindPasswdUser(t *testing.T) {
+	passwd := `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+ubuntu:x:1000:1000:Ubuntu:/home/ubuntu:/bin/bash`
+
+	user, err := findPasswdUser(passwd, "ubuntu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := hostUser{name: "ubuntu", uid: 1000, gid: 1000, home: "/home/ubuntu"}
+	if user != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, user)
+	}
+
+	if _, err := findPasswdUser(passwd, "missing"); err == nil {
+		t.Error("expected error for missing user")
+	}
+}
+
+func TestFindGroupID(t *testing.T) {
+	group := `root:x:0:
+adm:x:4:syslog,ubuntu
+docker:x:998:ubuntu`
+
+	gid, err := findGroupID(group, "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gid != 998 {
+		t.Errorf("expected: 998, got: %d", gid)
+	}
+
+	if _, err := findGroupID(group, "missing"); err == nil {
+		t.Error("expected error for missing group")
+	}
+}
+
+func TestPendingAction(t *testing.T) {
+	action := newPendingAction("files", "/etc/app.conf")
+	if action == newPendingAction("files", "/etc/app_conf") {
+		t.Error("actions of different keys must not share the marker")
+	}
+	action.path = filepath.Join(t.TempDir(), "pending", "files-test")
+
+	if pending, err := action.isPending(); err != nil || pending {
+		t.Fatalf("expected no pending action, got %t, %v", pending, err)
+	}
+	if err := action.mark(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := action.isPending(); err != nil || !pending {
+		t.Fatalf("expected a pending action, got %t, %v", pending, err)
+	}
+	if err := action.done(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := action.isPending(); err != nil || pending {
+		t.Fatalf("expected no pending action, got %t, %v", pending, err)
+	}
+}